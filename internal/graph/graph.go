@@ -0,0 +1,168 @@
+// Package graph renders the dependency graph of a parsed Makefile in
+// formats suitable for documentation
+package graph
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// Options selects the part of the graph to render and how
+type Options struct {
+	Roots         []string // Render only what these targets depend on; the whole graph when empty
+	CollapseFiles bool     // Hide file targets, linking their dependents to what they depend on
+	HideOrderOnly bool     // Leave out order-only prerequisites
+	ColorPhony    bool     // Highlight phony targets
+	ClusterByFile bool     // Group targets by the file that defines them
+}
+
+// Node is a target or a prerequisite without a rule, such as a source file
+type Node struct {
+	Name       string `json:"name"`
+	Target     bool   `json:"target"` // Whether the node has a rule
+	Phony      bool   `json:"phony"`
+	File       string `json:"file,omitempty"`
+	LineNumber int    `json:"lineNumber,omitempty"`
+}
+
+// Edge is a dependency of one node on another
+type Edge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	OrderOnly bool   `json:"orderOnly"`
+}
+
+// Graph is the part of a dependency graph selected for rendering. Nodes
+// follow target definition order, each target's prerequisites right after
+// their first use, and edges follow prerequisite order.
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+	nodes map[string]*Node
+}
+
+// Build selects the nodes and edges to render from a parsed Makefile
+func Build(p *parser.Parser, opts Options) (*Graph, error) {
+	mf := p.Makefile()
+	for _, root := range opts.Roots {
+		if _, ok := mf.Targets[root]; !ok {
+			return nil, fmt.Errorf("target not found: %s", root)
+		}
+	}
+
+	g := &Graph{Nodes: []*Node{}, Edges: []*Edge{}, nodes: make(map[string]*Node)}
+	edges := make(map[string][]*Edge)
+	var order []string
+	addNode := func(name string) {
+		if _, ok := g.nodes[name]; ok {
+			return
+		}
+		node := &Node{Name: name}
+		if t, ok := mf.Targets[name]; ok {
+			node.Target, node.Phony = true, t.IsPhony
+			node.File, node.LineNumber = t.File, t.LineNumber
+		}
+		g.nodes[name] = node
+		order = append(order, name)
+	}
+	for _, t := range p.OrderedTargets() {
+		if parser.IsSpecialTarget(t.Name) {
+			continue
+		}
+		addNode(t.Name)
+		for _, e := range p.Edges(t.Name) {
+			if e.OrderOnly && opts.HideOrderOnly {
+				continue
+			}
+			addNode(e.To)
+			edges[t.Name] = append(edges[t.Name], &Edge{From: e.From, To: e.To, OrderOnly: e.OrderOnly})
+		}
+	}
+
+	// Select what the roots depend on
+	selected := make(map[string]bool)
+	if len(opts.Roots) == 0 {
+		for _, name := range order {
+			selected[name] = true
+		}
+	} else {
+		var visit func(name string)
+		visit = func(name string) {
+			if selected[name] {
+				return
+			}
+			selected[name] = true
+			for _, e := range edges[name] {
+				visit(e.To)
+			}
+		}
+		for _, root := range opts.Roots {
+			visit(root)
+		}
+	}
+
+	// Collapsing keeps phony targets and the roots
+	keep := make(map[string]bool)
+	for _, name := range order {
+		keep[name] = selected[name] && (!opts.CollapseFiles || g.nodes[name].Phony || slices.Contains(opts.Roots, name))
+	}
+	kept := func(name string) bool { return keep[name] }
+	for _, name := range order {
+		if !keep[name] {
+			delete(g.nodes, name)
+			continue
+		}
+		g.Nodes = append(g.Nodes, g.nodes[name])
+		if !opts.CollapseFiles {
+			g.Edges = append(g.Edges, edges[name]...)
+			continue
+		}
+		g.Edges = append(g.Edges, collapsedEdges(name, edges, kept)...)
+	}
+	return g, nil
+}
+
+// collapsedEdges links a node to the nearest kept nodes it depends on,
+// through nodes that are not kept. A path is order-only if any of its
+// edges is.
+func collapsedEdges(from string, edges map[string][]*Edge, kept func(string) bool) []*Edge {
+	var result []*Edge
+	index := make(map[string]int)
+	// Nodes walked through, and whether only order-only paths reached them
+	visited := make(map[string]bool)
+	var walk func(name string, orderOnly bool)
+	walk = func(name string, orderOnly bool) {
+		for _, e := range edges[name] {
+			orderOnly := orderOnly || e.OrderOnly
+			if kept(e.To) {
+				if i, ok := index[e.To]; ok {
+					// A normal path wins over an order-only one
+					result[i].OrderOnly = result[i].OrderOnly && orderOnly
+					continue
+				}
+				index[e.To] = len(result)
+				result = append(result, &Edge{From: from, To: e.To, OrderOnly: orderOnly})
+				continue
+			}
+			if onlyOrderOnly, ok := visited[e.To]; !ok || (onlyOrderOnly && !orderOnly) {
+				visited[e.To] = orderOnly
+				walk(e.To, orderOnly)
+			}
+		}
+	}
+	walk(from, false)
+	return result
+}
+
+// files returns the files defining the nodes, in order of first use
+func (g *Graph) files() []string {
+	var files []string
+	for _, n := range g.Nodes {
+		if n.File != "" && !slices.Contains(files, n.File) {
+			files = append(files, n.File)
+		}
+	}
+	return files
+}
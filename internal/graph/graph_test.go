@@ -0,0 +1,164 @@
+package graph
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// parse reads a Makefile to render
+func parse(t *testing.T) *parser.Parser {
+	t.Helper()
+	p := parser.NewParser()
+	if _, err := p.ParseFile(filepath.Join("testdata", "Makefile")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	return p
+}
+
+// edgeList formats the edges of a graph as "from->to", with "|" for
+// order-only edges
+func edgeList(g *Graph) string {
+	edges := []string{}
+	for _, e := range g.Edges {
+		arrow := "->"
+		if e.OrderOnly {
+			arrow = "|"
+		}
+		edges = append(edges, e.From+arrow+e.To)
+	}
+	return strings.Join(edges, " ")
+}
+
+func TestBuild(t *testing.T) {
+	p := parse(t)
+
+	tests := []struct {
+		name  string
+		opts  Options
+		nodes string
+		edges string
+	}{
+		{
+			name:  "whole graph",
+			nodes: "all app out main.o util.o main.c config.h util.c release app.tar docs test",
+			edges: "all->app all|out app->main.o app->util.o main.o->main.c main.o->config.h util.o->util.c release->app.tar app.tar->app app.tar->docs test->app",
+		},
+		{
+			name:  "roots without order-only edges",
+			opts:  Options{Roots: []string{"app"}, HideOrderOnly: true},
+			nodes: "app main.o util.o main.c config.h util.c",
+			edges: "app->main.o app->util.o main.o->main.c main.o->config.h util.o->util.c",
+		},
+		{
+			name:  "collapsed file targets",
+			opts:  Options{CollapseFiles: true},
+			nodes: "all release docs test",
+			edges: "release->docs",
+		},
+		{
+			name:  "collapsed file targets keep the roots",
+			opts:  Options{Roots: []string{"all", "app"}, CollapseFiles: true},
+			nodes: "all app",
+			edges: "all->app",
+		},
+	}
+	for _, tt := range tests {
+		g, err := Build(p, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: failed to build graph: %v", tt.name, err)
+		}
+		nodes := []string{}
+		for _, n := range g.Nodes {
+			nodes = append(nodes, n.Name)
+		}
+		if strings.Join(nodes, " ") != tt.nodes {
+			t.Errorf("%s: expected nodes %q, got %q", tt.name, tt.nodes, strings.Join(nodes, " "))
+		}
+		if edgeList(g) != tt.edges {
+			t.Errorf("%s: expected edges %q, got %q", tt.name, tt.edges, edgeList(g))
+		}
+	}
+
+	if _, err := Build(p, Options{Roots: []string{"missing"}}); err == nil {
+		t.Error("Expected an error for an unknown root")
+	}
+}
+
+func TestRenderDOT(t *testing.T) {
+	out, _, err := Render(parse(t), "dot", Options{Roots: []string{"all"}, ColorPhony: true, ClusterByFile: true})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	expected := `digraph makefile {
+  node [shape=box];
+  subgraph cluster_0 {
+    label="testdata/Makefile";
+    "all" [style=filled, fillcolor="#cde4ff"];
+    "app";
+    "out";
+    "main.o";
+    "util.o";
+  }
+  "main.c" [shape=ellipse];
+  "config.h" [shape=ellipse];
+  "util.c" [shape=ellipse];
+  "all" -> "app";
+  "all" -> "out" [style=dashed];
+  "app" -> "main.o";
+  "app" -> "util.o";
+  "main.o" -> "main.c";
+  "main.o" -> "config.h";
+  "util.o" -> "util.c";
+}
+`
+	if out != expected {
+		t.Errorf("Unexpected DOT output:\n%s", out)
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	out, _, err := Render(parse(t), "mermaid", Options{Roots: []string{"release", "test"}, CollapseFiles: true, ColorPhony: true, ClusterByFile: true})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	expected := `flowchart TD
+  subgraph c0 ["testdata/Makefile"]
+    n0["release"]
+    n1["docs"]
+  end
+  subgraph c1 ["testdata/test.mk"]
+    n2["test"]
+  end
+  n0 --> n1
+  classDef phony fill:#cde4ff,stroke:#4a90d9
+  class n0,n1,n2 phony
+`
+	if out != expected {
+		t.Errorf("Unexpected Mermaid output:\n%s", out)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	out, g, err := Render(parse(t), "json", Options{Roots: []string{"test"}})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	var decoded Graph
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON output: %v", err)
+	}
+	if len(decoded.Nodes) != len(g.Nodes) || edgeList(&decoded) != edgeList(g) {
+		t.Errorf("JSON output doesn't match the graph: %s", out)
+	}
+	if test := decoded.Nodes[len(decoded.Nodes)-1]; test.Name != "test" || !test.Phony || test.File != filepath.Join("testdata", "test.mk") || test.LineNumber != 2 {
+		t.Errorf("Unexpected node for 'test': %+v", test)
+	}
+
+	if _, _, err := Render(parse(t), "svg", Options{}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
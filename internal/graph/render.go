@@ -0,0 +1,165 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"dot", "mermaid", "json"}
+
+// Render builds the graph of a parsed Makefile and renders it as Graphviz
+// DOT, a Mermaid flowchart or node/edge JSON
+func Render(p *parser.Parser, format string, opts Options) (string, *Graph, error) {
+	g, err := Build(p, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	switch format {
+	case "dot":
+		return g.DOT(opts), g, nil
+	case "mermaid":
+		return g.Mermaid(opts), g, nil
+	case "json":
+		data, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return "", nil, err
+		}
+		return string(data), g, nil
+	default:
+		return "", nil, fmt.Errorf("unknown graph format: %s", format)
+	}
+}
+
+// DOT renders the graph in the Graphviz DOT language. Targets are boxes,
+// prerequisites without a rule ellipses and order-only edges dashed.
+func (g *Graph) DOT(opts Options) string {
+	var b strings.Builder
+	b.WriteString("digraph makefile {\n")
+	b.WriteString("  node [shape=box];\n")
+
+	writeNode := func(indent string, n *Node) {
+		var attrs []string
+		if !n.Target {
+			attrs = append(attrs, "shape=ellipse")
+		}
+		if opts.ColorPhony && n.Phony {
+			attrs = append(attrs, "style=filled", `fillcolor="#cde4ff"`)
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(&b, "%s%s;\n", indent, dotID(n.Name))
+			return
+		}
+		fmt.Fprintf(&b, "%s%s [%s];\n", indent, dotID(n.Name), strings.Join(attrs, ", "))
+	}
+
+	if opts.ClusterByFile {
+		for i, file := range g.files() {
+			fmt.Fprintf(&b, "  subgraph cluster_%d {\n", i)
+			fmt.Fprintf(&b, "    label=%s;\n", dotID(file))
+			for _, n := range g.Nodes {
+				if n.File == file {
+					writeNode("    ", n)
+				}
+			}
+			b.WriteString("  }\n")
+		}
+		for _, n := range g.Nodes {
+			if n.File == "" {
+				writeNode("  ", n)
+			}
+		}
+	} else {
+		for _, n := range g.Nodes {
+			writeNode("  ", n)
+		}
+	}
+
+	for _, e := range g.Edges {
+		if e.OrderOnly {
+			fmt.Fprintf(&b, "  %s -> %s [style=dashed];\n", dotID(e.From), dotID(e.To))
+			continue
+		}
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotID(e.From), dotID(e.To))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotID quotes a name as a DOT identifier
+func dotID(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Nodes get generated
+// IDs since target names may contain characters Mermaid doesn't accept.
+// Targets are rectangles, prerequisites without a rule rounded and
+// order-only edges dotted.
+func (g *Graph) Mermaid(opts Options) string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	ids := make(map[string]string)
+	for i, n := range g.Nodes {
+		ids[n.Name] = fmt.Sprintf("n%d", i)
+	}
+	writeNode := func(indent string, n *Node) {
+		label := mermaidLabel(n.Name)
+		if n.Target {
+			fmt.Fprintf(&b, "%s%s[%s]\n", indent, ids[n.Name], label)
+			return
+		}
+		fmt.Fprintf(&b, "%s%s(%s)\n", indent, ids[n.Name], label)
+	}
+
+	if opts.ClusterByFile {
+		for i, file := range g.files() {
+			fmt.Fprintf(&b, "  subgraph c%d [%s]\n", i, mermaidLabel(file))
+			for _, n := range g.Nodes {
+				if n.File == file {
+					writeNode("    ", n)
+				}
+			}
+			b.WriteString("  end\n")
+		}
+		for _, n := range g.Nodes {
+			if n.File == "" {
+				writeNode("  ", n)
+			}
+		}
+	} else {
+		for _, n := range g.Nodes {
+			writeNode("  ", n)
+		}
+	}
+
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.OrderOnly {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", ids[e.From], arrow, ids[e.To])
+	}
+
+	if opts.ColorPhony {
+		var phony []string
+		for _, n := range g.Nodes {
+			if n.Phony {
+				phony = append(phony, ids[n.Name])
+			}
+		}
+		if len(phony) > 0 {
+			b.WriteString("  classDef phony fill:#cde4ff,stroke:#4a90d9\n")
+			fmt.Fprintf(&b, "  class %s phony\n", strings.Join(phony, ","))
+		}
+	}
+	return b.String()
+}
+
+// mermaidLabel quotes a name as a Mermaid label
+func mermaidLabel(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,3 @@
+# Run the tests
+test: app
+	./app --test
@@ -0,0 +1,189 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// maxMessageSize limits the length of a line read by Serve
+const maxMessageSize = 16 * 1024 * 1024
+
+// Handler handles a method. Its result is marshaled as the response's
+// result; for notifications both the result and the error are discarded.
+type Handler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// Dispatcher routes requests to the handlers registered for their method
+type Dispatcher struct {
+	mu      sync.RWMutex
+	methods map[string]Handler
+}
+
+// NewDispatcher creates a dispatcher without any methods
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		methods: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler of a method, replacing any previous one
+func (d *Dispatcher) Register(method string, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.methods[method] = handler
+}
+
+// Handle processes a message holding a request, a notification or a batch
+// of them, and returns the encoded reply, or nil when nothing must be
+// sent back: for notifications and batches made only of notifications
+func (d *Dispatcher) Handle(ctx context.Context, msg []byte) []byte {
+	var reply interface{}
+	switch firstByte(msg) {
+	case '[':
+		var batch []json.RawMessage
+		if err := json.Unmarshal(msg, &batch); err != nil {
+			reply = errorResponse(nullID, NewError(ParseError, "parse error: %v", err))
+			break
+		}
+		if len(batch) == 0 {
+			reply = errorResponse(nullID, NewError(InvalidRequest, "invalid request: empty batch"))
+			break
+		}
+		responses := []*Response{}
+		for _, item := range batch {
+			if resp := d.handleRequest(ctx, item); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		reply = responses
+	default:
+		if !json.Valid(msg) {
+			reply = errorResponse(nullID, NewError(ParseError, "parse error: invalid JSON"))
+			break
+		}
+		resp := d.handleRequest(ctx, msg)
+		if resp == nil {
+			return nil
+		}
+		reply = resp
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		// Responses only hold marshaled results, so this can't happen
+		data, _ = json.Marshal(errorResponse(nullID, NewError(InternalError, "internal error: %v", err)))
+	}
+	return data
+}
+
+// handleRequest runs a single request and returns its response, or nil
+// for a notification
+func (d *Dispatcher) handleRequest(ctx context.Context, msg json.RawMessage) *Response {
+	req, rpcErr := parseRequest(msg)
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+
+	d.mu.RLock()
+	handler, ok := d.methods[req.Method]
+	d.mu.RUnlock()
+	if !ok {
+		if req.IsNotification() {
+			return nil
+		}
+		return errorResponse(req.ID, NewError(MethodNotFound, "method not found: %s", req.Method))
+	}
+
+	result, err := call(ctx, handler, req.Params)
+	if req.IsNotification() {
+		if err != nil {
+			log.Printf("Notification %s failed: %v", req.Method, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return errorResponse(req.ID, toError(err))
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, NewError(InternalError, "failed to encode result: %v", err))
+	}
+	return &Response{JSONRPC: Version, ID: req.ID, Result: data}
+}
+
+// call runs a handler, turning a panic into an internal error
+func call(ctx context.Context, handler Handler, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = NewError(InternalError, "internal error: %v", r)
+		}
+	}()
+	return handler(ctx, params)
+}
+
+// toError converts a handler error to an error object
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &Error{Code: InternalError, Message: err.Error()}
+}
+
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	return &Response{JSONRPC: Version, ID: id, Error: err}
+}
+
+// Serve reads messages from r, one per line, and writes each reply to w on
+// a line of its own. It returns nil once r is exhausted, and ctx.Err() as
+// soon as ctx is done, after finishing the message being handled.
+func (d *Dispatcher) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte{}, scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	writer := bufio.NewWriter(w)
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case line = <-lines:
+		}
+		if firstByte(line) == 0 {
+			continue
+		}
+
+		reply := d.Handle(ctx, line)
+		if reply == nil {
+			continue
+		}
+		writer.Write(reply)
+		writer.WriteByte('\n')
+		if err := writer.Flush(); err != nil {
+			return fmt.Errorf("failed to write response: %w", err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package jsonrpc implements JSON-RPC 2.0 over line-delimited streams
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Version is the only protocol version accepted in requests
+const Version = "2.0"
+
+// Error codes defined by the JSON-RPC 2.0 specification
+const (
+	ParseError     = -32700 // Invalid JSON
+	InvalidRequest = -32600 // Valid JSON that is not a request object
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Request is a request or, without an ID, a notification
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification reports whether the request expects no response. A
+// request with a null ID still gets one.
+func (r *Request) IsNotification() bool {
+	return r.ID == nil
+}
+
+// Response is the reply to a request, with exactly one of Result and Error
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error object. Handlers return it to choose the
+// code; any other error is reported as an internal error.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// NewError creates an error with a code and a formatted message
+func NewError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// UnmarshalParams decodes the params of a request into v, reporting
+// malformed params as invalid. Absent params decode as an empty object.
+func UnmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(bytes.TrimSpace(params)) == 0 || bytes.Equal(bytes.TrimSpace(params), []byte("null")) {
+		params = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return NewError(InvalidParams, "invalid params: %v", err)
+	}
+	return nil
+}
+
+// nullID identifies the request in responses when its ID is unknown
+var nullID = json.RawMessage("null")
+
+// parseRequest validates a single request object. On error it returns the
+// request's ID if it could be read, so the error response can echo it.
+func parseRequest(msg json.RawMessage) (*Request, *Error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil || fields == nil {
+		return &Request{ID: nullID}, NewError(InvalidRequest, "invalid request: not an object")
+	}
+
+	req := &Request{}
+	if id, ok := fields["id"]; ok {
+		req.ID = id
+		var value interface{}
+		if err := json.Unmarshal(id, &value); err != nil {
+			return &Request{ID: nullID}, NewError(InvalidRequest, "invalid request: malformed id")
+		}
+		switch value.(type) {
+		case string, float64, nil:
+		default:
+			return &Request{ID: nullID}, NewError(InvalidRequest, "invalid request: id must be a string, number or null")
+		}
+	}
+	invalid := func(format string, args ...interface{}) (*Request, *Error) {
+		id := req.ID
+		if id == nil {
+			id = nullID
+		}
+		return &Request{ID: id}, NewError(InvalidRequest, "invalid request: "+format, args...)
+	}
+
+	if err := json.Unmarshal(fields["jsonrpc"], &req.JSONRPC); err != nil || req.JSONRPC != Version {
+		return invalid("jsonrpc must be %q", Version)
+	}
+	if err := json.Unmarshal(fields["method"], &req.Method); err != nil || req.Method == "" {
+		return invalid("method must be a non-empty string")
+	}
+	if params, ok := fields["params"]; ok {
+		switch firstByte(params) {
+		case '{', '[':
+			req.Params = params
+		default:
+			return invalid("params must be an object or an array")
+		}
+	}
+	return req, nil
+}
+
+// firstByte returns the first non-space byte of a JSON value
+func firstByte(data []byte) byte {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return 0
+	}
+	return data[0]
+}
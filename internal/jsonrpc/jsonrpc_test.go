@@ -0,0 +1,148 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// newTestDispatcher registers an echo method, a method rejecting its
+// params, a failing method and a notification counter
+func newTestDispatcher(notified *int) *Dispatcher {
+	d := NewDispatcher()
+	d.Register("echo", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var args struct {
+			Value string `json:"value"`
+		}
+		if err := UnmarshalParams(params, &args); err != nil {
+			return nil, err
+		}
+		return args.Value, nil
+	})
+	d.Register("fail", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	d.Register("panic", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		panic("oops")
+	})
+	d.Register("nothing", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return nil, nil
+	})
+	d.Register("notify", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		*notified++
+		return nil, errors.New("ignored")
+	})
+	return d
+}
+
+func TestHandle(t *testing.T) {
+	notified := 0
+	d := newTestDispatcher(&notified)
+
+	tests := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{"result", `{"jsonrpc":"2.0","id":1,"method":"echo","params":{"value":"hi"}}`,
+			`{"jsonrpc":"2.0","id":1,"result":"hi"}`},
+		{"string id", `{"jsonrpc":"2.0","id":"a-1","method":"echo","params":{"value":"hi"}}`,
+			`{"jsonrpc":"2.0","id":"a-1","result":"hi"}`},
+		{"id echoed as sent", `{"jsonrpc":"2.0","id":1.50,"method":"echo"}`,
+			`{"jsonrpc":"2.0","id":1.50,"result":""}`},
+		{"null id", `{"jsonrpc":"2.0","id":null,"method":"echo"}`,
+			`{"jsonrpc":"2.0","id":null,"result":""}`},
+		{"null result", `{"jsonrpc":"2.0","id":1,"method":"nothing"}`,
+			`{"jsonrpc":"2.0","id":1,"result":null}`},
+		{"parse error", `{"jsonrpc":"2.0","id":1,"method"`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: invalid JSON"}}`},
+		{"not an object", `"echo"`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request: not an object"}}`},
+		{"wrong version", `{"jsonrpc":"1.0","id":2,"method":"echo"}`,
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"invalid request: jsonrpc must be \"2.0\""}}`},
+		{"missing method", `{"jsonrpc":"2.0","id":3}`,
+			`{"jsonrpc":"2.0","id":3,"error":{"code":-32600,"message":"invalid request: method must be a non-empty string"}}`},
+		{"object id", `{"jsonrpc":"2.0","id":{},"method":"echo"}`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request: id must be a string, number or null"}}`},
+		{"scalar params", `{"jsonrpc":"2.0","id":4,"method":"echo","params":"hi"}`,
+			`{"jsonrpc":"2.0","id":4,"error":{"code":-32600,"message":"invalid request: params must be an object or an array"}}`},
+		{"method not found", `{"jsonrpc":"2.0","id":5,"method":"missing"}`,
+			`{"jsonrpc":"2.0","id":5,"error":{"code":-32601,"message":"method not found: missing"}}`},
+		{"invalid params", `{"jsonrpc":"2.0","id":6,"method":"echo","params":{"value":1}}`,
+			`{"jsonrpc":"2.0","id":6,"error":{"code":-32602,"message":"invalid params: json: cannot unmarshal number into Go struct field .value of type string"}}`},
+		{"internal error", `{"jsonrpc":"2.0","id":7,"method":"fail"}`,
+			`{"jsonrpc":"2.0","id":7,"error":{"code":-32603,"message":"boom"}}`},
+		{"panic", `{"jsonrpc":"2.0","id":8,"method":"panic"}`,
+			`{"jsonrpc":"2.0","id":8,"error":{"code":-32603,"message":"internal error: oops"}}`},
+		{"notification", `{"jsonrpc":"2.0","method":"notify"}`, ""},
+		{"unknown notification", `{"jsonrpc":"2.0","method":"missing"}`, ""},
+		{"batch", `[{"jsonrpc":"2.0","id":1,"method":"echo","params":{"value":"a"}},{"jsonrpc":"2.0","method":"notify"},1,{"jsonrpc":"2.0","id":2,"method":"missing"}]`,
+			`[{"jsonrpc":"2.0","id":1,"result":"a"},{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request: not an object"}},{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method not found: missing"}}]`},
+		{"batch of notifications", `[{"jsonrpc":"2.0","method":"notify"}]`, ""},
+		{"empty batch", `[]`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request: empty batch"}}`},
+		{"invalid batch", `[{"jsonrpc":"2.0","method":"echo"},`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: unexpected end of JSON input"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := d.Handle(context.Background(), []byte(tt.request))
+			if string(reply) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, reply)
+			}
+		})
+	}
+
+	if notified != 3 {
+		t.Errorf("Expected the notification handler to run 3 times, got %d", notified)
+	}
+}
+
+func TestServe(t *testing.T) {
+	notified := 0
+	d := newTestDispatcher(&notified)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"value":"a"}}`,
+		``,
+		`{"jsonrpc":"2.0","method":"notify"}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":2,"method":"echo","params":{"value":"b"}}`,
+	}, "\n")
+	var output bytes.Buffer
+	if err := d.Serve(context.Background(), strings.NewReader(input), &output); err != nil {
+		t.Fatalf("Failed to serve: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"result":"a"}`,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: invalid JSON"}}`,
+		`{"jsonrpc":"2.0","id":2,"result":"b"}`,
+	}, "\n") + "\n"
+	if output.String() != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+func TestServeCanceled(t *testing.T) {
+	d := newTestDispatcher(new(int))
+	ctx, cancel := context.WithCancel(context.Background())
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var output bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Serve(ctx, r, &output)
+	}()
+	w.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"value":"a"}}` + "\n"))
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled with the input still open, got %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+// Package lint checks parsed Makefiles against conventions that make
+// itself doesn't enforce
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// Severity ranks a finding
+type Severity int
+
+const (
+	SeverityError   Severity = iota // The Makefile is likely broken
+	SeverityWarning                 // The Makefile works but is fragile or misleading
+	SeverityInfo                    // A convention is not followed
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSeverity returns the severity with the given name
+func ParseSeverity(name string) (Severity, error) {
+	for _, s := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity: %s", name)
+}
+
+// Rule is a single lint check
+type Rule struct {
+	ID          string
+	Severity    Severity // Default severity of its findings
+	Description string
+	check       func(c *checker)
+}
+
+// Rules returns every lint rule, sorted by ID
+func Rules() []*Rule {
+	result := append([]*Rule{}, rules...)
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Finding is a problem reported by a rule
+type Finding struct {
+	Rule     string
+	Severity Severity
+	File     string
+	Range    parser.Range
+	Message  string
+}
+
+// String formats the finding like a make diagnostic, with the rule ID,
+// e.g. "Makefile:12: warning: target 'clean' is not declared .PHONY [missing-phony]"
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s [%s]", f.File, f.Range.Start.Line, f.Severity, f.Message, f.Rule)
+}
+
+// Config selects the rules to run and their severities
+type Config struct {
+	Enable     []string            // Run only these rules; every rule when empty
+	Disable    []string            // Never run these rules
+	Severities map[string]Severity // Severity overrides by rule ID
+}
+
+// suppressRegex matches suppression comments: "lint:ignore" silences the
+// statement it trails or precedes, "lint:disable" the whole file. Without
+// rule IDs every rule is silenced.
+var suppressRegex = regexp.MustCompile(`^#\s*lint:(ignore|disable)\b(.*)$`)
+
+// suppression silences rules for a span of lines of a file
+type suppression struct {
+	file      string
+	startLine int
+	endLine   int // 0 for the whole file
+	rules     []string
+}
+
+// covers reports whether the suppression silences rule at line of file
+func (s *suppression) covers(rule, file string, line int) bool {
+	if s.file != file || (s.endLine > 0 && (line < s.startLine || line > s.endLine)) {
+		return false
+	}
+	if len(s.rules) == 0 {
+		return true
+	}
+	for _, r := range s.rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// checker carries the state of one lint run
+type checker struct {
+	parser       *parser.Parser
+	makefile     *parser.Makefile
+	trees        []*parser.SyntaxTree // Syntax tree of every file read, in reading order
+	rule         *Rule
+	severity     Severity
+	findings     []*Finding
+	suppressions []*suppression
+}
+
+// Run checks a parsed Makefile and every file it included. Findings are
+// returned in file reading order, then by position.
+func Run(p *parser.Parser, config Config) ([]*Finding, error) {
+	known := make(map[string]bool)
+	for _, r := range rules {
+		known[r.ID] = true
+	}
+	for _, id := range append(append([]string{}, config.Enable...), config.Disable...) {
+		if !known[id] {
+			return nil, fmt.Errorf("unknown lint rule: %s", id)
+		}
+	}
+	for id := range config.Severities {
+		if !known[id] {
+			return nil, fmt.Errorf("unknown lint rule: %s", id)
+		}
+	}
+
+	c := &checker{parser: p, makefile: p.Makefile()}
+	for _, file := range c.makefile.Files {
+		// A file included twice is checked once
+		if c.tree(file) != nil {
+			continue
+		}
+		tree, err := parser.ParseSyntaxFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c.trees = append(c.trees, tree)
+		c.suppressions = append(c.suppressions, suppressions(tree)...)
+	}
+
+	for _, r := range rules {
+		if (len(config.Enable) > 0 && !slices.Contains(config.Enable, r.ID)) || slices.Contains(config.Disable, r.ID) {
+			continue
+		}
+		c.rule, c.severity = r, r.Severity
+		if s, ok := config.Severities[r.ID]; ok {
+			c.severity = s
+		}
+		r.check(c)
+	}
+
+	order := make(map[string]int)
+	for i, file := range c.makefile.Files {
+		if _, ok := order[file]; !ok {
+			order[file] = i
+		}
+	}
+	sort.SliceStable(c.findings, func(i, j int) bool {
+		a, b := c.findings[i], c.findings[j]
+		if a.File != b.File {
+			return order[a.File] < order[b.File]
+		}
+		return a.Range.Start.Offset < b.Range.Start.Offset
+	})
+	return c.findings, nil
+}
+
+// suppressions collects the suppression comments of a file
+func suppressions(tree *parser.SyntaxTree) []*suppression {
+	var result []*suppression
+	for i, stmt := range tree.Nodes {
+		comment := stmt
+		if stmt.Kind != parser.CommentNode {
+			comment = nil
+			for _, child := range stmt.Children {
+				if child.Kind == parser.CommentNode {
+					comment = child
+				}
+			}
+		}
+		if comment == nil {
+			continue
+		}
+		m := suppressRegex.FindStringSubmatch(strings.TrimSpace(comment.Text))
+		if m == nil {
+			continue
+		}
+
+		s := &suppression{
+			file:  tree.File,
+			rules: strings.FieldsFunc(m[2], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }),
+		}
+		if m[1] == "ignore" {
+			// A comment on its own line applies to the next statement
+			target := stmt
+			if stmt.Kind == parser.CommentNode {
+				target = nil
+				for _, next := range tree.Nodes[i+1:] {
+					if next.Kind != parser.CommentNode && next.Kind != parser.BlankNode {
+						target = next
+						break
+					}
+				}
+				if target == nil {
+					continue
+				}
+			}
+			s.startLine, s.endLine = target.Range.Start.Line, target.Range.End.Line
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// report records a finding of the current rule unless it is suppressed
+func (c *checker) report(file string, rng parser.Range, format string, args ...interface{}) {
+	for _, s := range c.suppressions {
+		if s.covers(c.rule.ID, file, rng.Start.Line) {
+			return
+		}
+	}
+	c.findings = append(c.findings, &Finding{
+		Rule:     c.rule.ID,
+		Severity: c.severity,
+		File:     file,
+		Range:    rng,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// tree returns the syntax tree of a file, or nil if it wasn't read
+func (c *checker) tree(file string) *parser.SyntaxTree {
+	for _, t := range c.trees {
+		if t.File == file {
+			return t
+		}
+	}
+	return nil
+}
+
+// statementRange returns the range of the statement covering line of
+// file, without leading blanks
+func (c *checker) statementRange(file string, line int) parser.Range {
+	if t := c.tree(file); t != nil {
+		for _, stmt := range t.Nodes {
+			if stmt.Range.Start.Line <= line && line <= stmt.Range.End.Line {
+				return trimmedRange(stmt)
+			}
+		}
+	}
+	pos := parser.Position{Line: line, Column: 1}
+	return parser.Range{Start: pos, End: pos}
+}
+
+// trimmedRange returns the range of a node without its leading blanks
+func trimmedRange(n *parser.Node) parser.Range {
+	rng := n.Range
+	indent := len(n.Text) - len(strings.TrimLeft(n.Text, " \t"))
+	rng.Start.Offset += indent
+	rng.Start.Column += indent
+	return rng
+}
@@ -0,0 +1,137 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// parse reads a Makefile for linting
+func parse(t *testing.T, path string) *parser.Parser {
+	t.Helper()
+	p := parser.NewParser()
+	if _, err := p.ParseFile(path); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	return p
+}
+
+func TestRun(t *testing.T) {
+	// Findings don't depend on the environment of the server
+	t.Setenv("MISSING_FLAGS", "-O2")
+
+	path := filepath.Join("testdata", "Makefile")
+	findings, err := Run(parse(t, path), Config{})
+	if err != nil {
+		t.Fatalf("Failed to lint: %v", err)
+	}
+
+	expected := []struct {
+		rule     string
+		line     int
+		severity Severity
+	}{
+		{"unused-variable", 3, SeverityInfo},
+		{"phony-without-rule", 8, SeverityWarning},
+		{"undefined-variable", 15, SeverityWarning},
+		{"missing-description", 17, SeverityInfo},
+		{"hardcoded-make", 18, SeverityWarning},
+		{"missing-phony", 24, SeverityWarning},
+		{"missing-make-var", 25, SeverityWarning},
+		{"duplicate-recipe", 27, SeverityWarning},
+		{"recipe-spaces", 31, SeverityError},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %d: %v", len(expected), len(findings), findings)
+	}
+	for i, want := range expected {
+		f := findings[i]
+		if f.Rule != want.rule || f.Range.Start.Line != want.line || f.Severity != want.severity || f.File != path {
+			t.Errorf("Finding %d: expected %s %s at line %d, got %v", i, want.severity, want.rule, want.line, f)
+		}
+	}
+
+	// Findings point at the offending text
+	if ghost := findings[1]; ghost.Range.Start.Column != 24 || ghost.Range.End.Column != 29 {
+		t.Errorf("Expected 'ghost' at columns 24-29, got %+v", ghost.Range)
+	}
+	if undefined := findings[2]; !strings.Contains(undefined.Message, "MISSING_FLAGS") || undefined.Range.Start.Column != 22 {
+		t.Errorf("Expected $(MISSING_FLAGS) at column 22, got %v %+v", undefined, undefined.Range)
+	}
+	if hardcoded := findings[4]; hardcoded.Range.Start.Column != 12 || hardcoded.Range.End.Column != 16 {
+		t.Errorf("Expected 'make' at columns 12-16, got %+v", hardcoded.Range)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	p := parse(t, filepath.Join("testdata", "Makefile"))
+
+	findings, err := Run(p, Config{
+		Enable:     []string{"hardcoded-make", "unused-variable"},
+		Disable:    []string{"unused-variable"},
+		Severities: map[string]Severity{"hardcoded-make": SeverityError},
+	})
+	if err != nil {
+		t.Fatalf("Failed to lint: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Rule != "hardcoded-make" || findings[0].Severity != SeverityError {
+		t.Errorf("Expected a single hardcoded-make error, got %v", findings)
+	}
+
+	if _, err := Run(p, Config{Disable: []string{"no-such-rule"}}); err == nil {
+		t.Error("Expected an error for an unknown rule")
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Makefile")
+	src := "# lint:disable missing-phony, hardcoded-make\n" +
+		"build:\n" +
+		"\tmake all\n" +
+		"A := 1 # lint:ignore\n" +
+		"# lint:ignore unused-variable\n" +
+		"\n" +
+		"B := 2\n" +
+		"C := 3\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("Failed to write Makefile: %v", err)
+	}
+
+	findings, err := Run(parse(t, path), Config{})
+	if err != nil {
+		t.Fatalf("Failed to lint: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Rule != "unused-variable" || !strings.Contains(findings[0].Message, "'C'") {
+		t.Errorf("Expected only the unused variable C, got %v", findings)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"$(CC) -o $@ $^", "CC @ ^"},
+		{"$$HOME ${DIR}/$(SRCS:.c=.o)", "DIR SRCS"},
+		{"$(foreach f,$(FILES),$(f) $(g))", "FILES g"},
+		{"$(call template,$(1)) $(origin NAME)", "template 1 NAME"},
+		{"$($(ARCH)_CFLAGS)", "<computed _CFLAGS> ARCH"},
+	}
+	for _, tt := range tests {
+		names := []string{}
+		for _, ref := range references(tt.text) {
+			if ref.computed {
+				names = append(names, "<computed "+strings.Join(ref.fragments, " ")+">")
+				continue
+			}
+			names = append(names, ref.name)
+		}
+		if strings.Join(names, " ") != tt.expected {
+			t.Errorf("%q: expected references %q, got %q", tt.text, tt.expected, strings.Join(names, " "))
+		}
+	}
+}
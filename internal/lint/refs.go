@@ -0,0 +1,187 @@
+package lint
+
+import (
+	"strings"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// reference is a variable reference found in Makefile text
+type reference struct {
+	name      string
+	offset    int      // Offset of the '$' in the scanned text
+	end       int      // Offset just after the reference
+	computed  bool     // The name contains references, e.g. $($(ARCH)_CFLAGS)
+	fragments []string // Literal parts of a computed name
+}
+
+// nameFunctions take a variable name as their first argument
+var nameFunctions = map[string]bool{
+	"call": true, "value": true, "origin": true, "flavor": true,
+}
+
+// scopeFunctions bind the names in their first argument while expanding
+// the rest, e.g. $(foreach f,$(SRCS),$(f))
+var scopeFunctions = map[string]bool{
+	"foreach": true, "let": true,
+}
+
+// references returns the variable references in text, including names
+// passed to functions such as $(call NAME) and excluding names bound by
+// $(foreach ...) and $(let ...)
+func references(text string) []reference {
+	var refs []reference
+	scanReferences(text, 0, map[string]bool{}, &refs)
+	return refs
+}
+
+// scanReferences appends the references in text, which starts at base in
+// the scanned text, to refs
+func scanReferences(text string, base int, locals map[string]bool, refs *[]reference) {
+	for i := 0; i+1 < len(text); i++ {
+		if text[i] != '$' {
+			continue
+		}
+		switch c := text[i+1]; c {
+		case '$':
+			i++
+		case '(', '{':
+			end := closingParen(text, i+1)
+			if end < 0 {
+				// The parser diagnoses unterminated references
+				return
+			}
+			scanReference(text[i+2:end], c, base+i, base+end+1, locals, refs)
+			i = end
+		default:
+			if !locals[string(c)] {
+				*refs = append(*refs, reference{name: string(c), offset: base + i, end: base + i + 2})
+			}
+			i++
+		}
+	}
+}
+
+// scanReference handles the contents of one $(...) or ${...} spanning
+// offset to end
+func scanReference(inner string, open byte, offset, end int, locals map[string]bool, refs *[]reference) {
+	innerBase := offset + 2
+	if idx := strings.IndexAny(inner, " \t"); idx > 0 && parser.IsFunction(inner[:idx]) {
+		name := inner[:idx]
+		argsStart := idx + len(inner[idx:]) - len(strings.TrimLeft(inner[idx:], " \t"))
+		args := splitArguments(inner[argsStart:], open)
+		pos := innerBase + argsStart
+
+		scoped := locals
+		for i, arg := range args {
+			switch {
+			case i == 0 && nameFunctions[name] && !strings.Contains(arg, "$"):
+				if n := strings.TrimSpace(arg); n != "" && !locals[n] {
+					*refs = append(*refs, reference{name: n, offset: offset, end: end})
+				}
+			case i == 0 && scopeFunctions[name]:
+				scanReferences(arg, pos, locals, refs)
+				scoped = make(map[string]bool)
+				for k := range locals {
+					scoped[k] = true
+				}
+				for _, n := range strings.Fields(arg) {
+					scoped[n] = true
+				}
+			case i == 1 && scopeFunctions[name]:
+				// The list is expanded before the names are bound
+				scanReferences(arg, pos, locals, refs)
+			default:
+				scanReferences(arg, pos, scoped, refs)
+			}
+			pos += len(arg) + 1
+		}
+		return
+	}
+
+	// $(VAR:a=b) is a substitution reference to VAR
+	name := inner
+	if colon := strings.IndexByte(inner, ':'); colon >= 0 && strings.Contains(inner[colon:], "=") {
+		name = inner[:colon]
+		scanReferences(inner[colon:], innerBase+colon, locals, refs)
+	}
+	if strings.Contains(name, "$") {
+		ref := reference{offset: offset, end: end, computed: true}
+		for _, part := range literalParts(name) {
+			if part != "" {
+				ref.fragments = append(ref.fragments, part)
+			}
+		}
+		*refs = append(*refs, ref)
+		scanReferences(name, innerBase, locals, refs)
+		return
+	}
+	if name = strings.TrimSpace(name); name != "" && !locals[name] {
+		*refs = append(*refs, reference{name: name, offset: offset, end: end})
+	}
+}
+
+// literalParts returns the text of name between its references
+func literalParts(name string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i+1 < len(name); i++ {
+		if name[i] != '$' {
+			continue
+		}
+		end := i + 1
+		if name[i+1] == '(' || name[i+1] == '{' {
+			if end = closingParen(name, i+1); end < 0 {
+				break
+			}
+		}
+		parts = append(parts, name[start:i])
+		start, i = end+1, end
+	}
+	return append(parts, name[start:])
+}
+
+// closingParen returns the index of the parenthesis closing the one at
+// open, or -1
+func closingParen(text string, open int) int {
+	openChar, closeChar := text[open], byte(')')
+	if openChar == '{' {
+		closeChar = '}'
+	}
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case openChar:
+			depth++
+		case closeChar:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitArguments splits function arguments at top-level commas
+func splitArguments(args string, open byte) []string {
+	closeChar := byte(')')
+	if open == '{' {
+		closeChar = '}'
+	}
+	var result []string
+	depth, start := 0, 0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case open:
+			depth++
+		case closeChar:
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, args[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, args[start:])
+}
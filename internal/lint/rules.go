@@ -0,0 +1,520 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// rules is the table of lint rules, in the order they run
+var rules []*Rule
+
+func init() {
+	rules = []*Rule{
+		{"missing-phony", SeverityWarning, "Target that never creates a file named after it is not declared .PHONY", checkMissingPhony},
+		{"phony-without-rule", SeverityWarning, ".PHONY names a target that has no rule", checkPhonyWithoutRule},
+		{"undefined-variable", SeverityWarning, "Variable is referenced but never defined", checkUndefinedVariables},
+		{"unused-variable", SeverityInfo, "Variable is defined but never referenced", checkUnusedVariables},
+		{"recipe-spaces", SeverityError, "Recipe line is indented with spaces instead of a tab", checkRecipeSpaces},
+		{"duplicate-recipe", SeverityWarning, "Target has more than one recipe, so all but the last are ignored", checkDuplicateRecipes},
+		{"missing-make-var", SeverityWarning, "Recursive make runs through a variable without $(MAKE) on the recipe line", checkMissingMakeVar},
+		{"hardcoded-make", SeverityWarning, "Recipe runs 'make' instead of $(MAKE)", checkHardcodedMake},
+		{"missing-description", SeverityInfo, "Phony target has no description comment", checkMissingDescription},
+	}
+}
+
+// builtinVariables are defined by make itself or used by its built-in rules
+var builtinVariables = map[string]bool{
+	"MAKE": true, "MAKEFLAGS": true, "MFLAGS": true, "MAKECMDGOALS": true, "MAKELEVEL": true,
+	"MAKEFILES": true, "MAKEFILE_LIST": true, "MAKE_VERSION": true, "MAKE_HOST": true,
+	"MAKE_RESTARTS": true, "MAKE_TERMOUT": true, "MAKE_TERMERR": true, "MAKEOVERRIDES": true,
+	"CURDIR": true, "SHELL": true, ".SHELLFLAGS": true, "VPATH": true, "SUFFIXES": true, "GPATH": true,
+	".DEFAULT_GOAL": true, ".RECIPEPREFIX": true, ".VARIABLES": true, ".FEATURES": true,
+	".INCLUDE_DIRS": true, ".EXTRA_PREREQS": true, ".LIBPATTERNS": true,
+	"AR": true, "AS": true, "CC": true, "CXX": true, "CPP": true, "FC": true, "M2C": true,
+	"PC": true, "CO": true, "GET": true, "LEX": true, "YACC": true, "LINT": true,
+	"MAKEINFO": true, "TEX": true, "TEXI2DVI": true, "WEAVE": true, "CWEAVE": true,
+	"TANGLE": true, "CTANGLE": true, "RM": true, "LD": true,
+	"ARFLAGS": true, "ASFLAGS": true, "CFLAGS": true, "CXXFLAGS": true, "COFLAGS": true,
+	"CPPFLAGS": true, "FFLAGS": true, "GFLAGS": true, "LDFLAGS": true, "LDLIBS": true,
+	"LFLAGS": true, "YFLAGS": true, "PFLAGS": true, "RFLAGS": true, "LINTFLAGS": true,
+	"TARGET_ARCH": true, "OUTPUT_OPTION": true,
+}
+
+// isAutomatic reports whether name is an automatic variable such as $@,
+// $(@D) or $(<F), or a $(call ...) argument such as $(1)
+func isAutomatic(name string) bool {
+	if strings.Trim(name, "0123456789") == "" {
+		return true
+	}
+	if len(name) == 2 && (name[1] == 'D' || name[1] == 'F') {
+		name = name[:1]
+	}
+	return len(name) == 1 && strings.Contains("@<^+?*%|", name)
+}
+
+// isKnown reports whether a reference to name needs no definition in the
+// Makefile. The environment of the server is not consulted, so a Makefile
+// lints the same wherever it is checked.
+func isKnown(name string) bool {
+	return builtinVariables[name] || isAutomatic(name)
+}
+
+// statementRefs calls fn for the references in every statement of every
+// file, trailing comments excluded. With deferred set, escaped references
+// such as $$(NAME) in define bodies count too, since templates passed to
+// $(eval ...) refer to variables that way.
+func (c *checker) statementRefs(deferred bool, fn func(tree *parser.SyntaxTree, stmt *parser.Node, ref reference)) {
+	for _, tree := range c.trees {
+		for _, stmt := range tree.Nodes {
+			if stmt.Kind == parser.CommentNode || stmt.Kind == parser.BlankNode {
+				continue
+			}
+			text := codeText(stmt)
+			if deferred && stmt.Kind == parser.DefineNode {
+				text = strings.ReplaceAll(text, "$$", " $")
+			}
+			for _, ref := range references(text) {
+				fn(tree, stmt, ref)
+			}
+		}
+	}
+}
+
+// codeText returns the text of a statement up to its trailing comment
+func codeText(stmt *parser.Node) string {
+	for _, child := range stmt.Children {
+		if child.Kind == parser.CommentNode {
+			return stmt.Text[:child.Range.Start.Offset-stmt.Range.Start.Offset]
+		}
+	}
+	return stmt.Text
+}
+
+// spanRange returns the range of bytes a to b of a node's text
+func spanRange(n *parser.Node, a, b int) parser.Range {
+	position := func(i int) parser.Position {
+		pos := n.Range.Start
+		pos.Offset += i
+		if nl := strings.LastIndexByte(n.Text[:i], '\n'); nl >= 0 {
+			pos.Line += strings.Count(n.Text[:i], "\n")
+			pos.Column = i - nl
+		} else {
+			pos.Column += i
+		}
+		return pos
+	}
+	return parser.Range{Start: position(a), End: position(b)}
+}
+
+// sortedTargets returns the targets of the Makefile sorted by name
+func (c *checker) sortedTargets() []*parser.Target {
+	targets := make([]*parser.Target, 0, len(c.makefile.Targets))
+	for _, t := range c.makefile.Targets {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets
+}
+
+// checkMissingPhony reports targets whose recipe never creates a file
+// named after the target, which make would skip if such a file appeared
+func checkMissingPhony(c *checker) {
+	dir := filepath.Dir(c.makefile.Path)
+	for _, t := range c.sortedTargets() {
+		if t.IsPhony || parser.IsSpecialTarget(t.Name) || strings.ContainsAny(t.Name, "./%$") || len(t.Commands) == 0 {
+			continue
+		}
+		if createsTarget(t) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, t.Name)); err == nil {
+			continue
+		}
+		c.report(t.File, c.statementRange(t.File, t.LineNumber), "target '%s' does not create a file named after it; declare it .PHONY", t.Name)
+	}
+}
+
+// createsTarget reports whether a recipe refers to its target as a file,
+// through $@ or as the output of commands such as touch, mkdir and cc -o
+func createsTarget(t *parser.Target) bool {
+	for _, command := range t.Commands {
+		if strings.Contains(command, "$@") || strings.Contains(command, "$(@") || strings.Contains(command, "${@") {
+			return true
+		}
+		words := strings.Fields(command)
+		for i := 1; i < len(words); i++ {
+			if words[i] != t.Name {
+				continue
+			}
+			switch words[i-1] {
+			case "-o", ">", ">>", "touch", "mkdir", "-p", "cp", "ln", "-s":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkPhonyWithoutRule reports .PHONY entries for targets with no rule
+func checkPhonyWithoutRule(c *checker) {
+	for _, name := range c.makefile.Phony {
+		if _, ok := c.makefile.Targets[name]; ok {
+			continue
+		}
+		file, rng := c.phonyEntry(name)
+		c.report(file, rng, "'%s' is declared .PHONY but has no rule", name)
+	}
+}
+
+// phonyEntry finds the .PHONY prerequisite naming a target, falling back
+// to the first .PHONY rule when the name comes from a variable
+func (c *checker) phonyEntry(name string) (string, parser.Range) {
+	var fallbackFile string
+	var fallback *parser.Node
+	for _, tree := range c.trees {
+		for _, stmt := range tree.Nodes {
+			if stmt.Kind != parser.RuleNode || len(stmt.Children) == 0 || stmt.Children[0].Text != ".PHONY" {
+				continue
+			}
+			for _, child := range stmt.Children {
+				if child.Kind == parser.PrerequisiteNode && child.Text == name {
+					return tree.File, child.Range
+				}
+			}
+			if fallback == nil {
+				fallbackFile, fallback = tree.File, stmt
+			}
+		}
+	}
+	if fallback == nil {
+		return c.makefile.Path, c.statementRange(c.makefile.Path, 1)
+	}
+	return fallbackFile, trimmedRange(fallback)
+}
+
+// definedVariables returns every variable name assigned anywhere, in
+// skipped conditional branches too
+func (c *checker) definedVariables() map[string]bool {
+	defined := make(map[string]bool)
+	for name := range c.makefile.Variables {
+		defined[name] = true
+	}
+	for _, vars := range c.makefile.TargetVariables {
+		for _, v := range vars {
+			defined[v.Name] = true
+		}
+	}
+	for _, v := range c.makefile.PatternVariables {
+		defined[v.Name] = true
+	}
+	for _, tree := range c.trees {
+		for _, stmt := range tree.Nodes {
+			if stmt.Kind != parser.AssignmentNode && stmt.Kind != parser.DefineNode {
+				continue
+			}
+			for _, child := range stmt.Children {
+				if child.Kind == parser.NameNode {
+					defined[child.Text] = true
+					break
+				}
+			}
+		}
+	}
+	return defined
+}
+
+// checkUndefinedVariables reports the first reference to each variable
+// that is defined neither in the Makefile nor by make
+func checkUndefinedVariables(c *checker) {
+	defined := c.definedVariables()
+	reported := make(map[string]bool)
+	c.statementRefs(false, func(tree *parser.SyntaxTree, stmt *parser.Node, ref reference) {
+		if ref.computed || defined[ref.name] || reported[ref.name] || isKnown(ref.name) {
+			return
+		}
+		reported[ref.name] = true
+		c.report(tree.File, spanRange(stmt, ref.offset, ref.end), "variable '%s' is referenced but never defined", ref.name)
+	})
+}
+
+// checkUnusedVariables reports global variables that nothing refers to.
+// Exported variables are used by the commands make runs.
+func checkUnusedVariables(c *checker) {
+	used := make(map[string]bool)
+	var fragments [][]string
+	c.statementRefs(true, func(tree *parser.SyntaxTree, stmt *parser.Node, ref reference) {
+		if ref.computed {
+			fragments = append(fragments, ref.fragments)
+		}
+		used[ref.name] = true
+	})
+	for _, f := range fragments {
+		// $($(NAME)) could refer to any variable
+		if len(f) == 0 {
+			return
+		}
+	}
+
+	type definition struct {
+		file string
+		node *parser.Node
+	}
+	var order []string
+	definitions := make(map[string]definition)
+	for _, tree := range c.trees {
+		for _, stmt := range tree.Nodes {
+			var name string
+			exported := false
+			switch stmt.Kind {
+			case parser.AssignmentNode, parser.DefineNode:
+				// Target-specific assignments modify another definition
+				if hasChild(stmt, parser.TargetNode) {
+					continue
+				}
+				for _, child := range stmt.Children {
+					if child.Kind == parser.KeywordNode && child.Text == "export" {
+						exported = true
+					}
+					if child.Kind == parser.NameNode && name == "" {
+						name = child.Text
+					}
+				}
+			case parser.DirectiveNode:
+				// export NAME, ifdef NAME and ifndef NAME use the names they list
+				if keyword := firstKeyword(stmt); keyword == "export" || keyword == "ifdef" || keyword == "ifndef" || keyword == "else" {
+					for _, child := range stmt.Children {
+						if child.Kind == parser.ArgumentNode {
+							for _, n := range strings.Fields(child.Text) {
+								used[n] = true
+							}
+						}
+					}
+					// A bare export exports every variable
+					if keyword == "export" && !hasChild(stmt, parser.ArgumentNode) {
+						return
+					}
+				}
+				continue
+			default:
+				continue
+			}
+			if name == "" || strings.Contains(name, "$") {
+				continue
+			}
+			if exported {
+				used[name] = true
+			}
+			if _, ok := definitions[name]; !ok {
+				definitions[name] = definition{tree.File, stmt}
+				order = append(order, name)
+			}
+		}
+	}
+
+	for _, name := range order {
+		if used[name] || builtinVariables[name] {
+			continue
+		}
+		if v, ok := c.makefile.Variables[name]; ok && v.IsExported {
+			continue
+		}
+		if matchesFragments(name, fragments) {
+			continue
+		}
+		def := definitions[name]
+		c.report(def.file, trimmedRange(def.node), "variable '%s' is defined but never used", name)
+	}
+}
+
+// matchesFragments reports whether a computed reference could name the
+// variable, because the variable contains all of its literal parts
+func matchesFragments(name string, fragments [][]string) bool {
+	for _, parts := range fragments {
+		rest, ok := name, true
+		for _, part := range parts {
+			idx := strings.Index(rest, part)
+			if idx < 0 {
+				ok = false
+				break
+			}
+			rest = rest[idx+len(part):]
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasChild reports whether a node has a child of the given kind
+func hasChild(n *parser.Node, kind parser.NodeKind) bool {
+	for _, child := range n.Children {
+		if child.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// firstKeyword returns the first keyword of a directive, skipping "else"
+// in "else ifdef NAME"
+func firstKeyword(n *parser.Node) string {
+	keyword := ""
+	for _, child := range n.Children {
+		if child.Kind != parser.KeywordNode {
+			break
+		}
+		keyword = child.Text
+		if keyword != "else" {
+			break
+		}
+	}
+	return keyword
+}
+
+// conditionalKeywords are the directives that may appear between recipe lines
+var conditionalKeywords = map[string]bool{
+	"ifeq": true, "ifneq": true, "ifdef": true, "ifndef": true, "else": true, "endif": true,
+}
+
+// checkRecipeSpaces reports lines after a rule that are indented with
+// spaces, which make reads as a missing separator rather than a recipe
+func checkRecipeSpaces(c *checker) {
+	for _, tree := range c.trees {
+		inRule := false
+		for _, stmt := range tree.Nodes {
+			switch stmt.Kind {
+			case parser.RuleNode:
+				inRule = true
+			case parser.RecipeNode, parser.BlankNode, parser.CommentNode:
+			case parser.DirectiveNode:
+				inRule = inRule && conditionalKeywords[firstKeyword(stmt)]
+			case parser.TextNode:
+				if inRule && strings.HasPrefix(stmt.Text, " ") {
+					c.report(tree.File, trimmedRange(stmt), "recipe line is indented with spaces instead of a tab")
+					continue
+				}
+				inRule = false
+			default:
+				inRule = false
+			}
+		}
+	}
+}
+
+// checkDuplicateRecipes reports rules whose recipe replaces an earlier
+// recipe for the same target
+func checkDuplicateRecipes(c *checker) {
+	for _, t := range c.sortedTargets() {
+		if t.DoubleColon {
+			continue
+		}
+		var withRecipe []*parser.Rule
+		for _, rule := range t.Rules {
+			if len(rule.Commands) > 0 {
+				withRecipe = append(withRecipe, rule)
+			}
+		}
+		for i := 1; i < len(withRecipe); i++ {
+			rule, previous := withRecipe[i], withRecipe[i-1]
+			c.report(rule.File, c.statementRange(rule.File, rule.LineNumber),
+				"recipe for target '%s' replaces the one at %s:%d", t.Name, previous.File, previous.LineNumber)
+		}
+	}
+}
+
+// makeCommandRegex matches make run as a command: at the start of a
+// recipe line, after a shell operator, or after a command prefix
+var makeCommandRegex = regexp.MustCompile(`(?:^[@+\-\s]*|[;&|(]\s*|\b(?:then|do|else|exec|time|xargs|command)\s+)((?:[\w./-]*/)?g?make)(?:\s|;|\)|$)`)
+
+// makeVarRegex matches a reference to the MAKE variable
+var makeVarRegex = regexp.MustCompile(`\$[({]MAKE[)}]`)
+
+// recipeLines calls fn for every recipe line, including recipes given
+// after ';' on the rule line
+func (c *checker) recipeLines(fn func(tree *parser.SyntaxTree, node *parser.Node)) {
+	for _, tree := range c.trees {
+		for _, stmt := range tree.Nodes {
+			switch stmt.Kind {
+			case parser.RecipeNode:
+				fn(tree, stmt)
+			case parser.RuleNode:
+				for _, child := range stmt.Children {
+					if child.Kind == parser.RecipeNode {
+						fn(tree, child)
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkHardcodedMake reports recipes that run make by name, which loses
+// the command line options, -n and the jobserver of the parent make
+func checkHardcodedMake(c *checker) {
+	c.recipeLines(func(tree *parser.SyntaxTree, node *parser.Node) {
+		if m := makeCommandRegex.FindStringSubmatchIndex(node.Text); m != nil {
+			c.report(tree.File, spanRange(node, m[2], m[3]), "recipe runs '%s' directly; use $(MAKE) instead", node.Text[m[2]:m[3]])
+		}
+	})
+}
+
+// checkMissingMakeVar reports recipe lines that run a sub-make through a
+// variable. make only treats a line as recursive, running it even under
+// -n, when $(MAKE) appears on the line itself or the line starts with '+'.
+func checkMissingMakeVar(c *checker) {
+	c.recipeLines(func(tree *parser.SyntaxTree, node *parser.Node) {
+		text := node.Text
+		prefix := strings.TrimLeft(text, " \t")
+		prefix = prefix[:len(prefix)-len(strings.TrimLeft(prefix, "@+-"))]
+		if strings.Contains(prefix, "+") || makeVarRegex.MatchString(text) || makeCommandRegex.MatchString(text) {
+			return
+		}
+		for _, ref := range references(text) {
+			if !ref.computed && c.invokesMake(ref.name, map[string]bool{}) {
+				c.report(tree.File, spanRange(node, ref.offset, ref.end),
+					"$(%s) runs make, but make can't tell the line is recursive; use $(MAKE) on the line or prefix it with '+'", ref.name)
+				return
+			}
+		}
+	})
+}
+
+// invokesMake reports whether the value of a variable, as written, runs
+// make directly or through other variables
+func (c *checker) invokesMake(name string, visited map[string]bool) bool {
+	v, ok := c.makefile.Variables[name]
+	if !ok || visited[name] {
+		return false
+	}
+	visited[name] = true
+	if makeVarRegex.MatchString(v.RawValue) || makeCommandRegex.MatchString(v.RawValue) {
+		return true
+	}
+	for _, ref := range references(v.RawValue) {
+		if !ref.computed && c.invokesMake(ref.name, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMissingDescription reports phony targets without a comment above
+// them, which list_targets would show without a description
+func checkMissingDescription(c *checker) {
+	for _, t := range c.sortedTargets() {
+		if !t.IsPhony || parser.IsSpecialTarget(t.Name) {
+			continue
+		}
+		// A suppression comment above the rule is not a description
+		if t.Description != "" && !suppressRegex.MatchString("# "+t.Description) {
+			continue
+		}
+		c.report(t.File, c.statementRange(t.File, t.LineNumber), "target '%s' has no description comment", t.Name)
+	}
+}
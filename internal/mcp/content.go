@@ -0,0 +1,38 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// toolResult wraps the result of a tool in an MCP tools/call result: the
+// result as JSON in a text block, for clients without structured content,
+// and the result itself as structuredContent
+func toolResult(result interface{}) (interface{}, error) {
+	// Recipes are full of '<', '>' and '&', which must read as written
+	var text strings.Builder
+	encoder := json.NewEncoder(&text)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(result); err != nil {
+		return nil, fmt.Errorf("failed to encode result: %w", err)
+	}
+	return map[string]interface{}{
+		"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": strings.TrimSuffix(text.String(), "\n")},
+		},
+		"structuredContent": result,
+		"isError":           false,
+	}, nil
+}
+
+// toolError reports a failed tool call to the model as a tools/call result
+// rather than a protocol error, so it can correct its arguments
+func toolError(err error) interface{} {
+	return map[string]interface{}{
+		"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": err.Error()},
+		},
+		"isError": true,
+	}
+}
@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// callTool calls a tool with JSON arguments and decodes its result
+func callTool(t *testing.T, s *Server, name string, args string) map[string]interface{} {
+	t.Helper()
+	result, err := s.CallTool(context.Background(), name, json.RawMessage(args))
+	if err != nil {
+		t.Fatalf("%s: unexpected protocol error: %v", name, err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("%s: failed to encode result: %v", name, err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("%s: failed to decode result: %v", name, err)
+	}
+	return decoded
+}
+
+func TestCallToolStructuredContent(t *testing.T) {
+	s := NewServer()
+	makefile := filepath.Join("testdata", "Makefile")
+	path := fmt.Sprintf("%q", makefile)
+
+	calls := map[string]string{
+		"list_targets":     `{"path":` + path + `,"include_inactive":true}`,
+		"get_target":       `{"path":` + path + `,"target":"app","expand_recipe":true}`,
+		"get_dependencies": `{"path":` + path + `,"target":"all","follow_submakes":true}`,
+		"list_variables":   `{"path":` + path + `}`,
+		"expand_variable":  `{"path":` + path + `,"variable":"CFLAGS","target":"app"}`,
+		"find_makefiles":   `{"root":"testdata"}`,
+		"get_diagnostics":  `{"path":` + path + `}`,
+		"find_cycles":      `{"path":` + path + `}`,
+		"render_graph":     `{"path":` + path + `,"format":"dot"}`,
+		"plan_build":       `{"path":` + path + `,"goals":["all","loop"]}`,
+		"check_stale":      `{"path":` + path + `,"goals":["app","loop"]}`,
+		"affected_targets": `{"path":` + path + `,"files":["main.c"]}`,
+		"lint_makefile":    `{"path":` + path + `}`,
+	}
+	if len(calls) != len(s.tools.Tools()) {
+		t.Fatalf("Expected a call for each of the %d tools, got %d", len(s.tools.Tools()), len(calls))
+	}
+
+	for name, args := range calls {
+		result := callTool(t, s, name, args)
+		if result["isError"] != false {
+			t.Errorf("%s: expected success, got %v", name, result)
+			continue
+		}
+
+		content, ok := result["content"].([]interface{})
+		if !ok || len(content) != 1 {
+			t.Errorf("%s: expected a single content block, got %v", name, result["content"])
+			continue
+		}
+		block := content[0].(map[string]interface{})
+		var text interface{}
+		if block["type"] != "text" || json.Unmarshal([]byte(block["text"].(string)), &text) != nil {
+			t.Errorf("%s: expected the result as JSON text, got %v", name, block)
+		}
+
+		for _, problem := range validate(name, s.tools.byName[name].OutputSchema, result["structuredContent"]) {
+			t.Error(problem)
+		}
+	}
+}
+
+func TestCallToolTargetsStructuredContent(t *testing.T) {
+	s := NewServer()
+	path := fmt.Sprintf("%q", filepath.Join("testdata", "Makefile"))
+
+	// Targets with and without recipes, prerequisites and rules
+	for _, target := range []string{"all", "app", "out", "loop", "main.o"} {
+		for _, name := range []string{"get_target", "get_dependencies"} {
+			result := callTool(t, s, name, `{"path":`+path+`,"target":"`+target+`"}`)
+			if name == "get_dependencies" && target == "main.o" {
+				// Only pattern rules make it, so it's not in the graph
+				continue
+			}
+			if result["isError"] != false {
+				t.Errorf("%s %s: expected success, got %v", name, target, result)
+				continue
+			}
+			for _, problem := range validate(name+" "+target, s.tools.byName[name].OutputSchema, result["structuredContent"]) {
+				t.Error(problem)
+			}
+		}
+	}
+}
+
+func TestCallToolTextUnescaped(t *testing.T) {
+	s := NewServer()
+	path := fmt.Sprintf("%q", filepath.Join("testdata", "Makefile"))
+
+	// The text block shows recipes as written, like structuredContent
+	result := callTool(t, s, "get_target", `{"path":`+path+`,"target":"main.o"}`)
+	text := result["content"].([]interface{})[0].(map[string]interface{})["text"].(string)
+	if !strings.Contains(text, "$<") || strings.Contains(text, `\u003c`) {
+		t.Errorf("Expected '$<' unescaped in the text block, got %s", text)
+	}
+}
+
+func TestCallToolErrors(t *testing.T) {
+	s := NewServer()
+	path := fmt.Sprintf("%q", filepath.Join("testdata", "Makefile"))
+
+	// Failures are results the model can act on
+	for _, args := range []string{
+		`{"path":` + path + `,"target":"missing"}`,
+		`{"path":` + path + `,"target":1}`,
+	} {
+		result := callTool(t, s, "get_target", args)
+		if result["isError"] != true || result["structuredContent"] != nil {
+			t.Errorf("Expected an error result for %s, got %v", args, result)
+			continue
+		}
+		text := result["content"].([]interface{})[0].(map[string]interface{})["text"].(string)
+		if text == "" {
+			t.Errorf("Expected an error message for %s", args)
+		}
+	}
+
+	// An unknown tool is a protocol error
+	if _, err := s.CallTool(context.Background(), "missing", nil); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Errorf("Expected an unknown tool error, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/jsonrpc"
+)
+
+// ProtocolVersions are the MCP protocol versions the server speaks, the
+// latest first
+var ProtocolVersions = []string{
+	"2025-11-25",
+	"2025-06-18",
+	"2025-03-26",
+	"2024-11-05",
+}
+
+// Server name and version reported by initialize
+const (
+	ServerName    = "mcp-server-makefile"
+	ServerVersion = "1.0.0"
+)
+
+// Initialize implements the MCP initialize handler. The server answers
+// with the client's protocol version if it supports it, and otherwise with
+// the latest one it supports, leaving the client to disconnect.
+func (s *Server) Initialize(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var args struct {
+		ProtocolVersion string                 `json:"protocolVersion"`
+		Capabilities    map[string]interface{} `json:"capabilities"`
+		ClientInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"clientInfo"`
+	}
+	if err := jsonrpc.UnmarshalParams(params, &args); err != nil {
+		return nil, err
+	}
+	if args.ProtocolVersion == "" {
+		return nil, jsonrpc.NewError(jsonrpc.InvalidParams, "missing protocolVersion")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.protocolVersion != "" {
+		return nil, jsonrpc.NewError(jsonrpc.InvalidRequest, "server already initialized")
+	}
+	version := ProtocolVersions[0]
+	for _, supported := range ProtocolVersions {
+		if supported == args.ProtocolVersion {
+			version = supported
+			break
+		}
+	}
+	s.protocolVersion = version
+
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"serverInfo": map[string]interface{}{
+			"name":    ServerName,
+			"version": ServerVersion,
+		},
+		"capabilities": map[string]interface{}{
+			"tools": map[string]interface{}{
+				"listChanged": false,
+			},
+			"resources": map[string]interface{}{
+				"subscribe":   false,
+				"listChanged": false,
+			},
+		},
+	}, nil
+}
+
+// Initialized implements the notifications/initialized handler, sent by
+// the client once it accepted the result of initialize
+func (s *Server) Initialized(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	if s.ProtocolVersion() == "" {
+		return nil, jsonrpc.NewError(jsonrpc.InvalidRequest, "initialized before initialize")
+	}
+	return nil, nil
+}
+
+// Ping implements the MCP ping handler, allowed at any time
+func (s *Server) Ping(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+// ProtocolVersion returns the negotiated protocol version, or an empty
+// string before initialize
+func (s *Server) ProtocolVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.protocolVersion
+}
+
+// requireInitialized rejects requests sent before initialize. Clients
+// should wait for notifications/initialized too, but some send requests
+// right after the initialize result, so those are served.
+func (s *Server) requireInitialized(handler jsonrpc.Handler) jsonrpc.Handler {
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		if s.ProtocolVersion() == "" {
+			return nil, jsonrpc.NewError(jsonrpc.InvalidRequest, "server not initialized")
+		}
+		return handler(ctx, params)
+	}
+}
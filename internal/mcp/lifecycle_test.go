@@ -0,0 +1,51 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/jsonrpc"
+)
+
+func TestLifecycle(t *testing.T) {
+	d := jsonrpc.NewDispatcher()
+	NewServer().Register(d)
+
+	steps := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{"ping before initialize", `{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+			`{"jsonrpc":"2.0","id":1,"result":{}}`},
+		{"request before initialize", `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"server not initialized"}}`},
+		{"missing version", `{"jsonrpc":"2.0","id":3,"method":"initialize","params":{}}`,
+			`{"jsonrpc":"2.0","id":3,"error":{"code":-32602,"message":"missing protocolVersion"}}`},
+		{"unsupported version", `{"jsonrpc":"2.0","id":4,"method":"initialize","params":{"protocolVersion":"1.0","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+			`{"jsonrpc":"2.0","id":4,"result":{"capabilities":{"resources":{"listChanged":false,"subscribe":false},"tools":{"listChanged":false}},"protocolVersion":"` + ProtocolVersions[0] + `","serverInfo":{"name":"mcp-server-makefile","version":"1.0.0"}}}`},
+		{"initialize twice", `{"jsonrpc":"2.0","id":5,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+			`{"jsonrpc":"2.0","id":5,"error":{"code":-32600,"message":"server already initialized"}}`},
+		{"initialized", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, ""},
+		{"ping", `{"jsonrpc":"2.0","id":6,"method":"ping","params":{}}`,
+			`{"jsonrpc":"2.0","id":6,"result":{}}`},
+	}
+	for _, step := range steps {
+		reply := d.Handle(context.Background(), []byte(step.request))
+		if string(reply) != step.expected {
+			t.Errorf("%s: expected %s, got %s", step.name, step.expected, reply)
+		}
+	}
+}
+
+func TestInitializeNegotiation(t *testing.T) {
+	for _, version := range ProtocolVersions {
+		s := NewServer()
+		d := jsonrpc.NewDispatcher()
+		s.Register(d)
+		d.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+version+`"}}`))
+		if s.ProtocolVersion() != version {
+			t.Errorf("Expected protocol version %s to be accepted, got %s", version, s.ProtocolVersion())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/jsonrpc"
+)
+
+// Tool is a tool declared with Go types for its arguments and result, as
+// reported by tools/list
+type Tool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"inputSchema"`
+	OutputSchema map[string]interface{} `json:"outputSchema"`
+	call         func(args json.RawMessage) (interface{}, error)
+}
+
+// NewTool declares a tool whose arguments decode into In and whose result
+// is Out. Both are structs, and the tool's schemas are derived from them.
+func NewTool[In, Out any](name, description string, handler func(In) (Out, error)) *Tool {
+	return &Tool{
+		Name:         name,
+		Description:  description,
+		InputSchema:  schemaFor(reflect.TypeFor[In]()),
+		OutputSchema: schemaFor(reflect.TypeFor[Out]()),
+		call: func(args json.RawMessage) (interface{}, error) {
+			var in In
+			if err := jsonrpc.UnmarshalParams(args, &in); err != nil {
+				return nil, err
+			}
+			return handler(in)
+		},
+	}
+}
+
+// WithEnum restricts an argument to values only known at run time, such
+// as the IDs of the lint rules
+func (t *Tool) WithEnum(argument string, values []string) *Tool {
+	properties := t.InputSchema["properties"].(map[string]interface{})
+	setEnum(properties[argument].(map[string]interface{}), values)
+	return t
+}
+
+// errUnknownTool is returned by Registry.Call for a name no tool has
+var errUnknownTool = errors.New("unknown tool")
+
+// Registry holds the tools of a server by name
+type Registry struct {
+	tools  []*Tool
+	byName map[string]*Tool
+}
+
+// NewRegistry creates a registry without any tools
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]*Tool),
+	}
+}
+
+// Register adds tools to the registry. Names must be unique.
+func (r *Registry) Register(tools ...*Tool) {
+	for _, t := range tools {
+		if _, ok := r.byName[t.Name]; ok {
+			panic(fmt.Sprintf("tool %s registered twice", t.Name))
+		}
+		r.tools = append(r.tools, t)
+		r.byName[t.Name] = t
+	}
+}
+
+// Tools returns the tools in the order they were registered
+func (r *Registry) Tools() []*Tool {
+	return r.tools
+}
+
+// Call validates the arguments of a tool against its input schema and
+// runs it
+func (r *Registry) Call(name string, args json.RawMessage) (interface{}, error) {
+	t, ok := r.byName[name]
+	if !ok {
+		return nil, errUnknownTool
+	}
+
+	var value interface{}
+	if err := jsonrpc.UnmarshalParams(args, &value); err != nil {
+		return nil, err
+	}
+	if problems := validate("arguments", t.InputSchema, value); len(problems) > 0 {
+		return nil, jsonrpc.NewError(jsonrpc.InvalidParams, "invalid arguments for %s: %s", name, strings.Join(problems, "; "))
+	}
+	return t.call(args)
+}
@@ -0,0 +1,146 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type sampleArgs struct {
+	Name    string            `json:"name" description:"Name"`
+	Count   int               `json:"count,omitempty"`
+	Tags    []string          `json:"tags,omitempty" enum:"a,b"`
+	Levels  map[string]string `json:"levels,omitempty" enum:"low,high"`
+	Nested  *sampleArgs       `json:"nested,omitempty"`
+	Ignored string            `json:"-"`
+	hidden  string
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := schemaFor(reflect.TypeFor[sampleArgs]())
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("Failed to encode schema: %v", err)
+	}
+
+	expected := `{"properties":{` +
+		`"count":{"type":"integer"},` +
+		`"levels":{"additionalProperties":{"enum":["low","high"],"type":"string"},"type":"object"},` +
+		`"name":{"description":"Name","type":"string"},` +
+		`"nested":{"type":"object"},` +
+		`"tags":{"items":{"enum":["a","b"],"type":"string"},"type":"array"}` +
+		`},"required":["name"],"type":"object"}`
+	if string(data) != expected {
+		t.Errorf("Expected schema %s, got %s", expected, data)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := schemaFor(reflect.TypeFor[sampleArgs]())
+	tests := []struct {
+		args     string
+		expected string
+	}{
+		{`{"name":"x","count":2,"tags":["a"],"levels":{"x":"low"},"other":1}`, ""},
+		{`{}`, `arguments: missing required property "name"`},
+		{`{"name":1}`, "arguments.name: expected a string, got an integer"},
+		{`{"name":"x","count":1.5}`, "arguments.count: expected an integer, got a number"},
+		{`{"name":"x","tags":"a"}`, "arguments.tags: expected an array, got a string"},
+		{`{"name":"x","tags":["c"]}`, `arguments.tags[0]: "c" is not one of a, b`},
+		{`{"name":"x","levels":{"x":"mid"}}`, `arguments.levels.x: "mid" is not one of low, high`},
+		{`[]`, "arguments: expected an object, got an array"},
+	}
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.args), &value); err != nil {
+			t.Fatalf("Invalid test arguments %s: %v", tt.args, err)
+		}
+		problems := strings.Join(validate("arguments", schema, value), "; ")
+		if problems != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.args, tt.expected, problems)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	called := 0
+	r.Register(NewTool("sample", "A sample tool", func(args sampleArgs) (*sampleArgs, error) {
+		called++
+		return &args, nil
+	}).WithEnum("name", []string{"x", "y"}))
+
+	result, err := r.Call("sample", json.RawMessage(`{"name":"x","count":3}`))
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if args := result.(*sampleArgs); args.Name != "x" || args.Count != 3 {
+		t.Errorf("Expected the decoded arguments, got %+v", args)
+	}
+
+	// Arguments are checked against the schema before the handler runs
+	if _, err := r.Call("sample", json.RawMessage(`{"name":"z"}`)); err == nil || !strings.Contains(err.Error(), `"z" is not one of x, y`) {
+		t.Errorf("Expected an enum error, got %v", err)
+	}
+	if _, err := r.Call("missing", nil); err != errUnknownTool {
+		t.Errorf("Expected errUnknownTool, got %v", err)
+	}
+	if called != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", called)
+	}
+}
+
+func TestListTools(t *testing.T) {
+	result, err := NewServer().ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list tools: %v", err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to encode tools: %v", err)
+	}
+	var listed struct {
+		Tools []struct {
+			Name         string                 `json:"name"`
+			Description  string                 `json:"description"`
+			InputSchema  map[string]interface{} `json:"inputSchema"`
+			OutputSchema map[string]interface{} `json:"outputSchema"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(data, &listed); err != nil {
+		t.Fatalf("Failed to decode tools: %v", err)
+	}
+
+	required := map[string]string{
+		"get_target":       "target",
+		"get_dependencies": "target",
+		"expand_variable":  "variable",
+		"affected_targets": "files",
+	}
+	names := []string{}
+	for _, tool := range listed.Tools {
+		names = append(names, tool.Name)
+		if tool.Description == "" || tool.InputSchema["type"] != "object" || tool.OutputSchema["type"] != "object" {
+			t.Errorf("Expected a description and object schemas for %s", tool.Name)
+		}
+		var got []string
+		list, _ := tool.InputSchema["required"].([]interface{})
+		for _, name := range list {
+			got = append(got, name.(string))
+		}
+		if want := required[tool.Name]; strings.Join(got, ",") != want {
+			t.Errorf("Expected %s to require %q, got %v", tool.Name, want, got)
+		}
+	}
+	if len(names) != 13 || names[0] != "list_targets" || names[12] != "lint_makefile" {
+		t.Errorf("Expected the 13 tools in declaration order, got %v", names)
+	}
+
+	// Values only known at run time are filled in
+	lint := listed.Tools[12].InputSchema["properties"].(map[string]interface{})["enable"].(map[string]interface{})
+	if enum, ok := lint["items"].(map[string]interface{})["enum"].([]interface{}); !ok || len(enum) == 0 {
+		t.Errorf("Expected the lint rule IDs as enum, got %v", lint)
+	}
+}
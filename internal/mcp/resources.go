@@ -0,0 +1,326 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/jsonrpc"
+	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
+)
+
+// ResourceNotFound is the JSON-RPC error code MCP uses for a resource URI
+// that names nothing
+const ResourceNotFound = -32002
+
+const (
+	resourceScheme   = "makefile://"
+	makefileMimeType = "text/x-makefile"
+)
+
+// resource describes a Makefile as reported by resources/list
+type resource struct {
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+// resourceTemplate describes a family of resources by an RFC 6570 URI
+// template, as reported by resources/templates/list
+type resourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+// resourceContents is the text of a resource returned by resources/read
+type resourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// resourceTemplates are the resources within a Makefile
+var resourceTemplates = []resourceTemplate{
+	{
+		URITemplate: resourceScheme + "{+path}",
+		Name:        "makefile",
+		Description: "Source of a Makefile",
+		MimeType:    makefileMimeType,
+	},
+	{
+		URITemplate: resourceScheme + "{+path}/targets/{name}",
+		Name:        "target",
+		Description: "Rules for a target as written, with the recipe make would run",
+		MimeType:    makefileMimeType,
+	},
+	{
+		URITemplate: resourceScheme + "{+path}/variables/{name}",
+		Name:        "variable",
+		Description: "Assignments of a variable as written, with its expanded value",
+		MimeType:    makefileMimeType,
+	},
+}
+
+// ListResources implements the MCP resources/list handler. Every Makefile
+// under the current directory is a resource; its targets and variables
+// are reached through the templates.
+func (s *Server) ListResources(ctx context.Context) (interface{}, error) {
+	makefiles, err := parser.FindMakefiles(".", "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Relative paths keep the URIs short and independent of the checkout
+	cwd, _ := os.Getwd()
+	resources := []resource{}
+	for _, path := range makefiles {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(cwd, path); err == nil {
+			path = rel
+		}
+		resources = append(resources, resource{
+			URI:      makefileURI(path),
+			Name:     filepath.ToSlash(path),
+			MimeType: makefileMimeType,
+			Size:     info.Size(),
+		})
+	}
+	return map[string]interface{}{"resources": resources}, nil
+}
+
+// ListResourceTemplates implements the MCP resources/templates/list handler
+func (s *Server) ListResourceTemplates(ctx context.Context) (interface{}, error) {
+	return map[string]interface{}{"resourceTemplates": resourceTemplates}, nil
+}
+
+// ReadResource implements the MCP resources/read handler. Only Makefiles
+// within the working directory and the files they include can be read.
+func (s *Server) ReadResource(ctx context.Context, uri string) (interface{}, error) {
+	path, kind, name, err := s.parseResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !s.isResource(path) {
+		return nil, jsonrpc.NewError(ResourceNotFound, "resource not found: %s", uri)
+	}
+
+	var text string
+	switch kind {
+	case "":
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(src)
+	case "targets":
+		text, err = s.targetSource(path, name)
+	case "variables":
+		text, err = s.variableSource(path, name)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, jsonrpc.NewError(ResourceNotFound, "resource not found: %s", uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"contents": []resourceContents{
+			{URI: uri, MimeType: makefileMimeType, Text: text},
+		},
+	}, nil
+}
+
+// targetSource returns the rules for a target as written, each headed by
+// the file and line it was read from, followed by the expanded recipe as
+// comments
+func (s *Server) targetSource(path, name string) (string, error) {
+	p, err := s.getParser(path)
+	if err != nil {
+		return "", err
+	}
+
+	sections := []string{}
+	if target, ok := p.Makefile().Targets[name]; ok {
+		for _, rule := range target.Rules {
+			sections = append(sections, sourceSection(p, rule.File, rule.LineNumber))
+		}
+	}
+	if len(sections) == 0 {
+		// Pattern rules are named by one of their target patterns
+		for _, rule := range p.Makefile().PatternRules {
+			for _, pattern := range rule.Targets {
+				if pattern == name {
+					sections = append(sections, sourceSection(p, rule.File, rule.LineNumber))
+				}
+			}
+		}
+		if len(sections) == 0 {
+			return "", fs.ErrNotExist
+		}
+		return strings.Join(sections, "\n\n") + "\n", nil
+	}
+
+	recipe, err := p.ExpandRecipe(name)
+	if err != nil {
+		sections = append(sections, "# Expanded recipe unavailable: "+err.Error())
+	} else if len(recipe) > 0 {
+		lines := []string{"# Expanded recipe:"}
+		for _, command := range recipe {
+			lines = append(lines, commentLines(command, "#\t"))
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	return strings.Join(sections, "\n\n") + "\n", nil
+}
+
+// variableSource returns the assignments of a variable as written,
+// target- and pattern-specific ones included, followed by its expanded
+// value as a comment
+func (s *Server) variableSource(path, name string) (string, error) {
+	p, err := s.getParser(path)
+	if err != nil {
+		return "", err
+	}
+	mf := p.Makefile()
+
+	sections := []string{}
+	if variable, ok := mf.Variables[name]; ok && variable.File != "" {
+		sections = append(sections, sourceSection(p, variable.File, variable.LineNumber))
+	}
+	scoped := append([]*parser.Variable{}, mf.PatternVariables...)
+	targets := make([]string, 0, len(mf.TargetVariables))
+	for target := range mf.TargetVariables {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		scoped = append(scoped, mf.TargetVariables[target]...)
+	}
+	for _, variable := range scoped {
+		if variable.Name == name {
+			sections = append(sections, sourceSection(p, variable.File, variable.LineNumber))
+		}
+	}
+	if len(sections) == 0 {
+		if _, ok := os.LookupEnv(name); !ok {
+			return "", fs.ErrNotExist
+		}
+		sections = append(sections, "# "+name+" comes from the environment")
+	}
+
+	expanded, err := p.ExpandVariable(name)
+	if err != nil {
+		sections = append(sections, "# Expanded value unavailable: "+err.Error())
+	} else {
+		sections = append(sections, "# Expanded value:\n"+commentLines(expanded, "#\t"))
+	}
+	return strings.Join(sections, "\n\n") + "\n", nil
+}
+
+// sourceSection returns the statement at a line of a file, headed by its
+// location
+func sourceSection(p *parser.Parser, file string, line int) string {
+	header := fmt.Sprintf("# %s:%d", file, line)
+	text, ok := p.SourceText(file, line)
+	if !ok {
+		return header
+	}
+	return header + "\n" + text
+}
+
+// commentLines prefixes every line of text so it reads as a comment
+func commentLines(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+// makefileURI returns the makefile:// URI of a file, with each path
+// segment escaped
+func makefileURI(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return resourceScheme + strings.Join(segments, "/")
+}
+
+// parseResourceURI splits a makefile:// URI into the cleaned path of the
+// file and, for a target or variable, its kind and name. A URI that could
+// name both a file in a directory called targets or variables and a
+// resource within a Makefile names the latter when the Makefile is a
+// resource.
+func (s *Server) parseResourceURI(uri string) (string, string, string, error) {
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	if !ok || rest == "" {
+		return "", "", "", jsonrpc.NewError(jsonrpc.InvalidParams, "unsupported resource URI: %s", uri)
+	}
+
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", "", "", jsonrpc.NewError(jsonrpc.InvalidParams, "invalid resource URI %s: %v", uri, err)
+		}
+		segments[i] = decoded
+	}
+
+	if n := len(segments); n >= 3 && (segments[n-2] == "targets" || segments[n-2] == "variables") {
+		path := filepath.Clean(filepath.FromSlash(strings.Join(segments[:n-2], "/")))
+		if s.isResource(path) {
+			return path, segments[n-2], segments[n-1], nil
+		}
+	}
+	return filepath.Clean(filepath.FromSlash(strings.Join(segments, "/"))), "", "", nil
+}
+
+// isResource reports whether path may be read as a resource: a regular
+// file within the working directory, symbolic links resolved, that is
+// either a Makefile resources/list would report or a file read while
+// parsing one
+func (s *Server) isResource(path string) bool {
+	if !filepath.IsLocal(path) {
+		return false
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	root, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(cwd, path))
+	if err != nil {
+		return false
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	if parser.IsMakefile(path, "") {
+		return true
+	}
+	for _, p := range s.cache {
+		for _, file := range p.Makefile().Files {
+			if filepath.Clean(file) == path {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cappyzawa/mcp-server-makefile/internal/jsonrpc"
+)
+
+// readResource reads a resource and returns its text
+func readResource(t *testing.T, s *Server, uri string) string {
+	t.Helper()
+	result, err := s.ReadResource(context.Background(), uri)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", uri, err)
+	}
+	contents := result.(map[string]interface{})["contents"].([]resourceContents)
+	if len(contents) != 1 || contents[0].URI != uri || contents[0].MimeType != makefileMimeType {
+		t.Fatalf("%s: unexpected contents %+v", uri, contents)
+	}
+	return contents[0].Text
+}
+
+func TestListResources(t *testing.T) {
+	result, err := NewServer().ListResources(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resources := result.(map[string]interface{})["resources"].([]resource)
+	found := false
+	for _, r := range resources {
+		if r.URI == "makefile://testdata/Makefile" && r.Name == "testdata/Makefile" && r.Size > 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected testdata/Makefile to be listed, got %+v", resources)
+	}
+}
+
+func TestReadResource(t *testing.T) {
+	s := NewServer()
+	makefile := filepath.Join("testdata", "Makefile")
+
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"makefile://testdata/Makefile/targets/app",
+			"# " + makefile + ":8\napp: $(OBJS)\n\t$(CC) $(CFLAGS) -o $@ $^\n\n" +
+				"# Expanded recipe:\n#\tcc -O2 -g -o app main.o util.o\n"},
+		{"makefile://testdata/Makefile/targets/%25.o",
+			"# " + makefile + ":11\n%.o: %.c\n\t$(CC) $(CFLAGS) -c $<\n"},
+		{"makefile://testdata/Makefile/variables/CFLAGS",
+			"# " + makefile + ":2\nCFLAGS := -O2\n\n" +
+				"# " + makefile + ":14\napp: CFLAGS += -g\n\n" +
+				"# Expanded value:\n#\t-O2\n"},
+	}
+	for _, tt := range tests {
+		if text := readResource(t, s, tt.uri); text != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.uri, tt.expected, text)
+		}
+	}
+
+	if text := readResource(t, s, "makefile://testdata/Makefile"); !strings.HasPrefix(text, "CC ?= cc\n") {
+		t.Errorf("Expected the source of the Makefile, got %q", text)
+	}
+
+	errorCodes := map[string]int{
+		"makefile://testdata/missing.mk":                 ResourceNotFound,
+		"makefile://testdata/Makefile/targets/missing":   ResourceNotFound,
+		"makefile://testdata/Makefile/variables/MISSING": ResourceNotFound,
+		"makefile://testdata":                            ResourceNotFound,
+		"makefile:///etc/passwd":                         ResourceNotFound,
+		"makefile://../../../../../../etc/passwd":        ResourceNotFound,
+		"makefile://testdata/../../../go.mod":            ResourceNotFound,
+		"makefile://%2E%2E/%2E%2E/go.mod":                ResourceNotFound,
+		"makefile://testdata/main.c":                     ResourceNotFound,
+		"makefile://resources.go/targets/all":            ResourceNotFound,
+		"file:///etc/passwd":                             jsonrpc.InvalidParams,
+		"makefile://testdata/%zz":                        jsonrpc.InvalidParams,
+	}
+	for uri, code := range errorCodes {
+		_, err := s.ReadResource(context.Background(), uri)
+		var rpcErr *jsonrpc.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != code {
+			t.Errorf("%s: expected error code %d, got %v", uri, code, err)
+		}
+	}
+}
+
+func TestReadResourceContinuedLines(t *testing.T) {
+	t.Chdir(t.TempDir())
+	src := "SRCS = a.c \\\n\tb.c\n\nbuild: a \\\n\tb\n\t@echo done\n"
+	if err := os.WriteFile("Makefile", []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Statements continued with a backslash are found by their first line
+	s := NewServer()
+	if text, expected := readResource(t, s, "makefile://Makefile/targets/build"),
+		"# Makefile:4\nbuild: a \\\n\tb\n\t@echo done\n\n# Expanded recipe:\n#\t@echo done\n"; text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+	if text, expected := readResource(t, s, "makefile://Makefile/variables/SRCS"),
+		"# Makefile:1\nSRCS = a.c \\\n\tb.c\n\n# Expanded value:\n"; !strings.HasPrefix(text, expected) {
+		t.Errorf("Expected %q to start with %q", text, expected)
+	}
+	result := callTool(t, s, "get_target", `{"target":"build"}`)
+	if line := result["structuredContent"].(map[string]interface{})["lineNumber"]; line != 4.0 {
+		t.Errorf("Expected get_target to report line 4, got %v", line)
+	}
+}
+
+func TestReadResourceSymlink(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile("Makefile", []byte("all:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, "escape.mk"); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+
+	s := NewServer()
+	if text := readResource(t, s, "makefile://Makefile"); text != "all:\n" {
+		t.Errorf("Expected the source of the Makefile, got %q", text)
+	}
+	_, err := s.ReadResource(context.Background(), "makefile://escape.mk")
+	var rpcErr *jsonrpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != ResourceNotFound {
+		t.Errorf("Expected a link out of the working directory to be rejected, got %v", err)
+	}
+}
+
+func TestParseResourceURI(t *testing.T) {
+	s := NewServer()
+	tests := []struct {
+		uri                string
+		path, kind, target string
+	}{
+		{"makefile://Makefile", "Makefile", "", ""},
+		{"makefile://testdata/Makefile/targets/out%2Fapp", filepath.Join("testdata", "Makefile"), "targets", "out/app"},
+		{"makefile://testdata/Makefile/variables/CC", filepath.Join("testdata", "Makefile"), "variables", "CC"},
+		// Without a Makefile named "missing", targets is a directory
+		{"makefile://missing/targets/Makefile", filepath.FromSlash("missing/targets/Makefile"), "", ""},
+		{"makefile://my%20dir/Makefile", "my dir" + string(filepath.Separator) + "Makefile", "", ""},
+	}
+	for _, tt := range tests {
+		path, kind, name, err := s.parseResourceURI(tt.uri)
+		if err != nil || path != tt.path || kind != tt.kind || name != tt.target {
+			t.Errorf("%s: expected %q %q %q, got %q %q %q (%v)", tt.uri, tt.path, tt.kind, tt.target, path, kind, name, err)
+		}
+		if tt.kind == "" && makefileURI(path) != tt.uri {
+			t.Errorf("Expected %s to round trip, got %s", tt.uri, makefileURI(path))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package mcp
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// schemaFor derives the JSON Schema of a Go type from its struct tags:
+//
+//   - json names a field; fields without omitempty are required
+//   - description documents a field
+//   - enum lists the values allowed, comma separated, for a string field or
+//     the elements of a slice or map of strings
+//
+// Recursive types are described as plain objects where they recur.
+func schemaFor(t reflect.Type) map[string]interface{} {
+	return typeSchema(t, map[reflect.Type]bool{})
+}
+
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, omitempty, ok := jsonField(field)
+			if !ok {
+				continue
+			}
+			schema := typeSchema(field.Type, visiting)
+			if description := field.Tag.Get("description"); description != "" {
+				schema["description"] = description
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				setEnum(schema, strings.Split(enum, ","))
+			}
+			properties[name] = schema
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// Any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+// jsonField returns the JSON name of an exported struct field and whether
+// it is omitted when empty
+func jsonField(field reflect.StructField) (string, bool, bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(","+options+",", ",omitempty,"), true
+}
+
+// setEnum restricts the values of a string schema, or of the elements of
+// an array or map schema
+func setEnum(schema map[string]interface{}, values []string) {
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		setEnum(items, values)
+		return
+	}
+	if elem, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		setEnum(elem, values)
+		return
+	}
+	schema["enum"] = values
+}
+
+// validate checks a decoded JSON value against the subset of JSON Schema
+// schemaFor produces, and returns a description of each violation
+func validate(path string, schema map[string]interface{}, value interface{}) []string {
+	problems := []string{}
+	fail := func(format string, args ...interface{}) []string {
+		return append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("expected an object, got %s", jsonType(value))
+		}
+		if required, ok := schema["required"].([]string); ok {
+			for _, name := range required {
+				if _, ok := object[name]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing required property %q", path, name))
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				property = additional
+			}
+			if property != nil {
+				problems = append(problems, validate(path+"."+name, property, object[name])...)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fail("expected an array, got %s", jsonType(value))
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			problems = append(problems, validate(fmt.Sprintf("%s[%d]", path, i), items, item)...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fail("expected a string, got %s", jsonType(value))
+		}
+		if enum, ok := schema["enum"].([]string); ok && !slices.Contains(enum, s) {
+			return fail("%q is not one of %s", s, strings.Join(enum, ", "))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("expected a boolean, got %s", jsonType(value))
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			return fail("expected an integer, got %s", jsonType(value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fail("expected a number, got %s", jsonType(value))
+		}
+	}
+	return problems
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "an integer"
+		}
+		return "a number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
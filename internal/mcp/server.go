@@ -3,436 +3,1177 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/cappyzawa/mcp-server-makefile/internal/graph"
+	"github.com/cappyzawa/mcp-server-makefile/internal/jsonrpc"
+	"github.com/cappyzawa/mcp-server-makefile/internal/lint"
 	"github.com/cappyzawa/mcp-server-makefile/internal/parser"
 )
 
 // Server implements the MCP server for Makefile exploration
 type Server struct {
-	parser *parser.Parser
-	cache  map[string]*parser.Makefile
+	includeDirs     []string
+	allowShell      bool
+	cache           map[string]*parser.Parser
+	tools           *Registry
+	mu              sync.Mutex
+	protocolVersion string // Negotiated by initialize, empty before
 }
 
 // NewServer creates a new MCP server instance
 func NewServer() *Server {
-	return &Server{
-		parser: parser.NewParser(),
-		cache:  make(map[string]*parser.Makefile),
+	s := &Server{
+		cache: make(map[string]*parser.Parser),
+		tools: NewRegistry(),
 	}
+	s.registerTools()
+	return s
 }
 
-// Initialize implements the MCP initialize handler
-func (s *Server) Initialize(ctx context.Context, params json.RawMessage) (interface{}, error) {
-	return map[string]interface{}{
-		"protocolVersion": "1.0",
-		"serverInfo": map[string]interface{}{
-			"name":    "mcp-server-makefile",
-			"version": "1.0.0",
-		},
-		"capabilities": map[string]interface{}{
-			"tools": map[string]interface{}{
-				"available": true,
-			},
-		},
-	}, nil
+// SetIncludeDirs sets the directories searched for included Makefiles
+func (s *Server) SetIncludeDirs(dirs []string) {
+	s.includeDirs = dirs
+}
+
+// SetAllowShell controls whether $(shell ...) is run during expansion
+func (s *Server) SetAllowShell(allow bool) {
+	s.allowShell = allow
+}
+
+// Register adds the MCP methods of the server to a JSON-RPC dispatcher.
+// Only initialize and ping are accepted before initialization.
+func (s *Server) Register(d *jsonrpc.Dispatcher) {
+	d.Register("initialize", s.Initialize)
+	d.Register("notifications/initialized", s.Initialized)
+	d.Register("ping", s.Ping)
+	d.Register("tools/list", s.requireInitialized(func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return s.ListTools(ctx)
+	}))
+	d.Register("tools/call", s.requireInitialized(func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var call struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments,omitempty"`
+		}
+		if err := jsonrpc.UnmarshalParams(params, &call); err != nil {
+			return nil, err
+		}
+		if call.Name == "" {
+			return nil, jsonrpc.NewError(jsonrpc.InvalidParams, "missing tool name")
+		}
+		return s.CallTool(ctx, call.Name, call.Arguments)
+	}))
+	d.Register("resources/list", s.requireInitialized(func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return s.ListResources(ctx)
+	}))
+	d.Register("resources/templates/list", s.requireInitialized(func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return s.ListResourceTemplates(ctx)
+	}))
+	d.Register("resources/read", s.requireInitialized(func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var read struct {
+			URI string `json:"uri"`
+		}
+		if err := jsonrpc.UnmarshalParams(params, &read); err != nil {
+			return nil, err
+		}
+		if read.URI == "" {
+			return nil, jsonrpc.NewError(jsonrpc.InvalidParams, "missing resource uri")
+		}
+		return s.ReadResource(ctx, read.URI)
+	}))
+}
+
+// registerTools declares the tools of the server, in the order tools/list
+// reports them
+func (s *Server) registerTools() {
+	ruleIDs := []string{}
+	for _, rule := range lint.Rules() {
+		ruleIDs = append(ruleIDs, rule.ID)
+	}
+
+	s.tools.Register(
+		NewTool("list_targets", "List all targets in the Makefile", s.listTargets),
+		NewTool("get_target", "Get detailed information about a specific target", s.getTarget),
+		NewTool("get_dependencies", "Get dependency graph for a target, with any circular dependencies it is part of or depends on, optionally across recursive make invocations", s.getDependencies),
+		NewTool("list_variables", "List all variables defined in the Makefile", s.listVariables),
+		NewTool("expand_variable", "Expand a variable to its full value", s.expandVariable),
+		NewTool("find_makefiles", "Find all Makefiles in the project", s.findMakefiles),
+		NewTool("get_diagnostics", "Report syntax errors and warnings make would print while reading the Makefile and its includes", s.getDiagnostics),
+		NewTool("find_cycles", "Find circular dependencies between targets, with the rule lines forming each edge and the edges make drops with \"Circular X <- Y dependency dropped\"", s.findCycles),
+		NewTool("render_graph", "Render the dependency graph, or the part of it the given targets depend on, as Graphviz DOT, a Mermaid flowchart or node/edge JSON", s.renderGraph).
+			WithEnum("format", graph.Formats),
+		NewTool("plan_build", "Plan the order in which make would update targets for the given goals without running anything, with the layers of targets that can run in parallel with -j", s.planBuild),
+		NewTool("check_stale", "Compare file timestamps along the dependency graph of the given goals and report which targets are up to date, which make would rebuild and why", s.checkStale),
+		NewTool("affected_targets", "List every target make would rebuild after the given files changed, following explicit prerequisites, pattern rules and included dependency files", s.affectedTargets),
+		NewTool("lint_makefile", "Check the Makefile against conventions such as .PHONY declarations, $(MAKE) for recursive make and target descriptions. Findings can be suppressed with '# lint:ignore <rule>' on or above a line, or '# lint:disable <rule>' for a whole file.", s.lintMakefile).
+			WithEnum("enable", ruleIDs).
+			WithEnum("disable", ruleIDs),
+	)
 }
 
 // ListTools implements the MCP tools/list handler
 func (s *Server) ListTools(ctx context.Context) (interface{}, error) {
 	return map[string]interface{}{
-		"tools": []interface{}{
-			map[string]interface{}{
-				"name":        "list_targets",
-				"description": "List all targets in the Makefile",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"path": map[string]interface{}{
-							"type":        "string",
-							"description": "Path to the Makefile (optional, defaults to ./Makefile)",
-						},
-					},
-				},
-			},
-			map[string]interface{}{
-				"name":        "get_target",
-				"description": "Get detailed information about a specific target",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"target": map[string]interface{}{
-							"type":        "string",
-							"description": "Target name",
-						},
-						"path": map[string]interface{}{
-							"type":        "string",
-							"description": "Path to the Makefile (optional)",
-						},
-					},
-					"required": []string{"target"},
-				},
-			},
-			map[string]interface{}{
-				"name":        "get_dependencies",
-				"description": "Get dependency graph for a target",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"target": map[string]interface{}{
-							"type":        "string",
-							"description": "Target name",
-						},
-						"path": map[string]interface{}{
-							"type":        "string",
-							"description": "Path to the Makefile (optional)",
-						},
-						"max_depth": map[string]interface{}{
-							"type":        "integer",
-							"description": "Maximum dependency depth (optional)",
-						},
-					},
-					"required": []string{"target"},
-				},
-			},
-			map[string]interface{}{
-				"name":        "list_variables",
-				"description": "List all variables defined in the Makefile",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"path": map[string]interface{}{
-							"type":        "string",
-							"description": "Path to the Makefile (optional)",
-						},
-						"include_env": map[string]interface{}{
-							"type":        "boolean",
-							"description": "Include environment variables (default: false)",
-						},
-					},
-				},
-			},
-			map[string]interface{}{
-				"name":        "expand_variable",
-				"description": "Expand a variable to its full value",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"variable": map[string]interface{}{
-							"type":        "string",
-							"description": "Variable name",
-						},
-						"path": map[string]interface{}{
-							"type":        "string",
-							"description": "Path to the Makefile (optional)",
-						},
-					},
-					"required": []string{"variable"},
-				},
-			},
-			map[string]interface{}{
-				"name":        "find_makefiles",
-				"description": "Find all Makefiles in the project",
-				"inputSchema": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"root": map[string]interface{}{
-							"type":        "string",
-							"description": "Root directory to search (optional, defaults to current directory)",
-						},
-						"pattern": map[string]interface{}{
-							"type":        "string",
-							"description": "File pattern to match (optional, defaults to common Makefile names)",
-						},
-					},
-				},
-			},
-		},
+		"tools": s.tools.Tools(),
 	}, nil
 }
 
-// CallTool implements the MCP tools/call handler
+// CallTool implements the MCP tools/call handler. Only an unknown tool is
+// a protocol error; tools report their failures in the result.
 func (s *Server) CallTool(ctx context.Context, name string, args json.RawMessage) (interface{}, error) {
-	switch name {
-	case "list_targets":
-		return s.listTargets(args)
-	case "get_target":
-		return s.getTarget(args)
-	case "get_dependencies":
-		return s.getDependencies(args)
-	case "list_variables":
-		return s.listVariables(args)
-	case "expand_variable":
-		return s.expandVariable(args)
-	case "find_makefiles":
-		return s.findMakefiles(args)
-	default:
-		return nil, fmt.Errorf("unknown tool: %s", name)
+	result, err := s.tools.Call(name, args)
+	if errors.Is(err, errUnknownTool) {
+		return nil, jsonrpc.NewError(jsonrpc.InvalidParams, "unknown tool: %s", name)
 	}
+	if err != nil {
+		return toolError(err), nil
+	}
+	return toolResult(result)
 }
 
-func (s *Server) getMakefile(path string) (*parser.Makefile, error) {
+func (s *Server) getParser(path string) (*parser.Parser, error) {
 	if path == "" {
 		path = "Makefile"
 	}
 
 	// Check cache
-	if mf, ok := s.cache[path]; ok {
-		return mf, nil
+	if p, ok := s.cache[path]; ok {
+		return p, nil
 	}
 
 	// Parse the file
-	mf, err := s.parser.ParseFile(path)
-	if err != nil {
+	p := parser.NewParser()
+	p.SetIncludeDirs(s.includeDirs)
+	p.SetAllowShell(s.allowShell)
+	if _, err := p.ParseFile(path); err != nil {
 		return nil, err
 	}
 
 	// Cache the result
-	s.cache[path] = mf
-	return mf, nil
+	s.cache[path] = p
+	return p, nil
 }
 
-func (s *Server) listTargets(args json.RawMessage) (interface{}, error) {
-	var params struct {
-		Path string `json:"path,omitempty"`
-	}
-	if err := json.Unmarshal(args, &params); err != nil {
+func (s *Server) getMakefile(path string) (*parser.Makefile, error) {
+	p, err := s.getParser(path)
+	if err != nil {
 		return nil, err
 	}
+	return p.Makefile(), nil
+}
+
+type listTargetsArgs struct {
+	Path            string `json:"path,omitempty" description:"Path to the Makefile (optional, defaults to ./Makefile)"`
+	IncludeInactive bool   `json:"include_inactive,omitempty" description:"Include targets from conditional branches make would skip (default: false)"`
+}
+
+type listTargetsResult struct {
+	Targets      []targetSummary   `json:"targets"`
+	PatternRules []patternRuleInfo `json:"patternRules"`
+	Diagnostics  []diagnosticInfo  `json:"diagnostics"`
+}
+
+// targetSummary describes a target in a list of targets
+type targetSummary struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Dependencies []string `json:"dependencies"`
+	IsPhony      bool     `json:"isPhony"`
+	File         string   `json:"file"`
+	LineNumber   int      `json:"lineNumber"`
+	Condition    string   `json:"condition" description:"Conditional branches enclosing the rule, empty at top level"`
+	Active       bool     `json:"active" description:"Whether make reads the rule, false in a skipped conditional branch"`
+}
 
+type patternRuleInfo struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	File        string `json:"file"`
+	LineNumber  int    `json:"lineNumber"`
+}
+
+func (s *Server) listTargets(params listTargetsArgs) (*listTargetsResult, error) {
 	mf, err := s.getMakefile(params.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	targets := []map[string]interface{}{}
+	summary := func(name string, target *parser.Target, active bool) targetSummary {
+		return targetSummary{
+			Name:         name,
+			Description:  target.Description,
+			Dependencies: target.Dependencies,
+			IsPhony:      target.IsPhony,
+			File:         target.File,
+			LineNumber:   target.LineNumber,
+			Condition:    conditionText(target.Condition),
+			Active:       active,
+		}
+	}
+	targets := []targetSummary{}
 	for name, target := range mf.Targets {
-		targets = append(targets, map[string]interface{}{
-			"name":         name,
-			"description":  target.Description,
-			"dependencies": target.Dependencies,
-			"isPhony":      target.IsPhony,
-			"lineNumber":   target.LineNumber,
+		targets = append(targets, summary(name, target, true))
+	}
+
+	// Targets from skipped branches are only reachable through the conditional tree
+	if params.IncludeInactive {
+		var walk func(blocks []*parser.Conditional)
+		walk = func(blocks []*parser.Conditional) {
+			for _, block := range blocks {
+				for _, branch := range block.Branches {
+					for _, target := range branch.Targets {
+						if mf.Targets[target.Name] == target {
+							continue
+						}
+						targets = append(targets, summary(target.Name, target, false))
+					}
+					walk(branch.Nested)
+				}
+			}
+		}
+		walk(mf.Conditionals)
+	}
+
+	patternRules := []patternRuleInfo{}
+	for _, rule := range mf.PatternRules {
+		patternRules = append(patternRules, patternRuleInfo{
+			Rule:        rule.String(),
+			Description: rule.Description,
+			File:        rule.File,
+			LineNumber:  rule.LineNumber,
 		})
 	}
 
-	return map[string]interface{}{
-		"targets": targets,
+	return &listTargetsResult{
+		Targets:      targets,
+		PatternRules: patternRules,
+		Diagnostics:  diagnosticInfos(mf.Diagnostics),
 	}, nil
 }
 
-func (s *Server) getTarget(args json.RawMessage) (interface{}, error) {
-	var params struct {
-		Target string `json:"target"`
-		Path   string `json:"path,omitempty"`
+// diagnosticInfo describes a warning or error found while reading a Makefile
+type diagnosticInfo struct {
+	Severity   string    `json:"severity"`
+	Code       string    `json:"code"`
+	File       string    `json:"file"`
+	LineNumber int       `json:"lineNumber"`
+	Range      rangeInfo `json:"range"`
+	Message    string    `json:"message"`
+	Text       string    `json:"text" description:"The diagnostic as make prints it"`
+}
+
+func diagnosticInfos(diagnostics []*parser.Diagnostic) []diagnosticInfo {
+	result := []diagnosticInfo{}
+	for _, d := range diagnostics {
+		result = append(result, diagnosticInfo{
+			Severity:   d.Severity.String(),
+			Code:       d.Code,
+			File:       d.File,
+			LineNumber: d.Range.Start.Line,
+			Range:      newRangeInfo(d.Range),
+			Message:    d.Message,
+			Text:       d.String(),
+		})
 	}
-	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, err
+	return result
+}
+
+// rangeInfo describes a span of source text
+type rangeInfo struct {
+	Start positionInfo `json:"start"`
+	End   positionInfo `json:"end"`
+}
+
+type positionInfo struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+func newRangeInfo(r parser.Range) rangeInfo {
+	position := func(pos parser.Position) positionInfo {
+		return positionInfo{Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
 	}
+	return rangeInfo{Start: position(r.Start), End: position(r.End)}
+}
 
-	mf, err := s.getMakefile(params.Path)
+// targetDiagnostics returns the diagnostics reported at the rules of a target
+func targetDiagnostics(mf *parser.Makefile, target *parser.Target) []*parser.Diagnostic {
+	result := []*parser.Diagnostic{}
+	for _, d := range mf.Diagnostics {
+		for _, rule := range target.Rules {
+			if d.File == rule.File && d.Range.Start.Line == rule.LineNumber && strings.Contains(d.Message, "'"+target.Name+"'") {
+				result = append(result, d)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// conditionText describes the chain of conditional branches enclosing a
+// definition, e.g. "ifneq ($(DEBUG),) > ifdef VERBOSE". It is empty at top level.
+func conditionText(branch *parser.ConditionalBranch) string {
+	if branch == nil {
+		return ""
+	}
+	parts := []string{}
+	for _, b := range branch.Path() {
+		first := b.Conditional.Branches[0]
+		switch {
+		case b == first:
+			parts = append(parts, b.String())
+		case b.Kind == parser.Else:
+			parts = append(parts, "else of "+first.String())
+		default:
+			parts = append(parts, "else "+b.String())
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+type getTargetArgs struct {
+	Target       string `json:"target" description:"Target name"`
+	Path         string `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	ExpandRecipe bool   `json:"expand_recipe,omitempty" description:"Also return each command line fully expanded for this target, with automatic variables like $@ and $< (default: false)"`
+}
+
+type getTargetResult struct {
+	Name                  string            `json:"name"`
+	Description           string            `json:"description,omitempty"`
+	Dependencies          []string          `json:"dependencies"`
+	OrderOnlyDependencies []string          `json:"orderOnlyDependencies"`
+	Commands              []string          `json:"commands"`
+	ExpandedCommands      []string          `json:"expandedCommands,omitempty"`
+	IsPhony               bool              `json:"isPhony"`
+	File                  string            `json:"file,omitempty"`
+	LineNumber            int               `json:"lineNumber,omitempty"`
+	Condition             string            `json:"condition,omitempty"`
+	DoubleColon           bool              `json:"doubleColon,omitempty"`
+	Rules                 []ruleInfo        `json:"rules,omitempty" description:"Every rule defining the target, possibly in different files"`
+	Diagnostics           []diagnosticInfo  `json:"diagnostics,omitempty"`
+	Group                 []string          `json:"group,omitempty" description:"All targets of a grouped rule"`
+	StaticPattern         string            `json:"staticPattern,omitempty"`
+	Stem                  string            `json:"stem,omitempty"`
+	Variables             []variableInfo    `json:"variables,omitempty" description:"Target- and pattern-specific variables applying to the target"`
+	ImplicitRule          *implicitRuleInfo `json:"implicitRule,omitempty" description:"Pattern rule make uses for a target without a recipe"`
+}
+
+// ruleInfo describes one of the rules defining a target
+type ruleInfo struct {
+	Dependencies          []string `json:"dependencies"`
+	OrderOnlyDependencies []string `json:"orderOnlyDependencies"`
+	Commands              []string `json:"commands"`
+	Description           string   `json:"description"`
+	File                  string   `json:"file"`
+	LineNumber            int      `json:"lineNumber"`
+	Overridden            bool     `json:"overridden" description:"Whether a later rule's recipe replaces this one"`
+}
+
+func (s *Server) getTarget(params getTargetArgs) (*getTargetResult, error) {
+	p, err := s.getParser(params.Path)
 	if err != nil {
 		return nil, err
 	}
+	mf := p.Makefile()
+
+	var expanded []string
+	if params.ExpandRecipe {
+		if expanded, err = p.ExpandRecipe(params.Target); err != nil {
+			return nil, err
+		}
+	}
 
 	target, ok := mf.Targets[params.Target]
 	if !ok {
-		return nil, fmt.Errorf("target not found: %s", params.Target)
+		// Targets without an explicit rule may still be built by a pattern rule
+		match, found := p.FindImplicitRule(params.Target)
+		if !found {
+			return nil, fmt.Errorf("target not found: %s", params.Target)
+		}
+		return &getTargetResult{
+			Name:                  params.Target,
+			Dependencies:          match.Dependencies,
+			OrderOnlyDependencies: match.OrderOnly,
+			Commands:              match.Rule.Commands,
+			ExpandedCommands:      expanded,
+			ImplicitRule:          newImplicitRuleInfo(match),
+		}, nil
 	}
 
-	return map[string]interface{}{
-		"name":         target.Name,
-		"description":  target.Description,
-		"dependencies": target.Dependencies,
-		"commands":     target.Commands,
-		"isPhony":      target.IsPhony,
-		"lineNumber":   target.LineNumber,
-	}, nil
+	result := &getTargetResult{
+		Name:                  target.Name,
+		Description:           target.Description,
+		Dependencies:          target.Dependencies,
+		OrderOnlyDependencies: target.OrderOnly,
+		Commands:              target.Commands,
+		ExpandedCommands:      expanded,
+		IsPhony:               target.IsPhony,
+		File:                  target.File,
+		LineNumber:            target.LineNumber,
+		Condition:             conditionText(target.Condition),
+		DoubleColon:           target.DoubleColon,
+		Rules:                 []ruleInfo{},
+		Diagnostics:           diagnosticInfos(targetDiagnostics(mf, target)),
+		Group:                 target.Group,
+		Variables:             targetVariableInfo(p.TargetSpecificVariables(target.Name), ""),
+	}
+	// A target may be defined by several rules, possibly in different files
+	for _, rule := range target.Rules {
+		result.Rules = append(result.Rules, ruleInfo{
+			Dependencies:          rule.Dependencies,
+			OrderOnlyDependencies: rule.OrderOnly,
+			Commands:              rule.Commands,
+			Description:           rule.Description,
+			File:                  rule.File,
+			LineNumber:            rule.LineNumber,
+			Overridden:            rule.Overridden,
+		})
+	}
+	if target.StaticPattern != nil {
+		result.StaticPattern = target.StaticPattern.String()
+		result.Stem = target.Stem
+	}
+	// make searches implicit rules for targets that have no recipe
+	if len(target.Commands) == 0 && !target.IsPhony {
+		if match, found := p.FindImplicitRule(target.Name); found {
+			result.ImplicitRule = newImplicitRuleInfo(match)
+		}
+	}
+	return result, nil
 }
 
-func (s *Server) getDependencies(args json.RawMessage) (interface{}, error) {
-	var params struct {
-		Target   string `json:"target"`
-		Path     string `json:"path,omitempty"`
-		MaxDepth int    `json:"max_depth,omitempty"`
+// implicitRuleInfo describes how a pattern rule builds a target
+type implicitRuleInfo struct {
+	Target        string             `json:"target"`
+	Rule          string             `json:"rule"`
+	Stem          string             `json:"stem"`
+	Prerequisites []string           `json:"prerequisites"`
+	OrderOnly     []string           `json:"orderOnly"`
+	Commands      []string           `json:"commands"`
+	File          string             `json:"file"`
+	LineNumber    int                `json:"lineNumber"`
+	Chain         []implicitRuleInfo `json:"chain" description:"Rules building intermediate prerequisites"`
+}
+
+func newImplicitRuleInfo(match *parser.ImplicitMatch) *implicitRuleInfo {
+	chain := []implicitRuleInfo{}
+	for _, sub := range match.Chain {
+		chain = append(chain, *newImplicitRuleInfo(sub))
 	}
-	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, err
+	return &implicitRuleInfo{
+		Target:        match.Target,
+		Rule:          match.Rule.String(),
+		Stem:          match.Stem,
+		Prerequisites: match.Dependencies,
+		OrderOnly:     match.OrderOnly,
+		Commands:      match.Rule.Commands,
+		File:          match.Rule.File,
+		LineNumber:    match.Rule.LineNumber,
+		Chain:         chain,
 	}
+}
 
+type getDependenciesArgs struct {
+	Target         string `json:"target" description:"Target name"`
+	Path           string `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	MaxDepth       int    `json:"max_depth,omitempty" description:"Maximum dependency depth (optional)"`
+	FollowSubMakes bool   `json:"follow_submakes,omitempty" description:"Follow recursive $(MAKE) -C dir and -f file invocations in recipes into the targets of the Makefiles they read (default: false)"`
+}
+
+type getDependenciesResult struct {
+	Target       string         `json:"target"`
+	Dependencies []string       `json:"dependencies"`
+	Graph        dependencyNode `json:"graph"`
+	Cycles       []cycleInfo    `json:"cycles" description:"Circular dependencies reachable from the target"`
+	SubMakes     []subMakeInfo  `json:"subMakes,omitempty"`
+}
+
+type dependencyNode struct {
+	DirectDependencies    []string `json:"directDependencies"`
+	OrderOnlyDependencies []string `json:"orderOnlyDependencies"`
+	GeneratedDependencies []string `json:"generatedDependencies" description:"Prerequisites only listed in compiler-generated dependency files"`
+	Dependents            []string `json:"dependents"`
+}
+
+func (s *Server) getDependencies(params getDependenciesArgs) (*getDependenciesResult, error) {
 	if params.MaxDepth == 0 {
 		params.MaxDepth = 10 // Default max depth
 	}
 
-	mf, err := s.getMakefile(params.Path)
+	p, err := s.getParser(params.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update parser's makefile reference
-	s.parser = parser.NewParser()
-	s.parser.ParseFile(mf.Path)
-
-	deps, err := s.parser.GetTargetDependencies(params.Target, params.MaxDepth)
+	var deps []string
+	var subMakes []*parser.SubMake
+	if params.FollowSubMakes {
+		deps, subMakes, err = p.GetStitchedDependencies(params.Target, params.MaxDepth)
+	} else {
+		deps, err = p.GetTargetDependencies(params.Target, params.MaxDepth)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Build dependency tree
-	graph := s.parser.BuildDependencyGraph()
+	graph := p.BuildDependencyGraph()
 	node, ok := graph.Nodes[params.Target]
 	if !ok {
 		return nil, fmt.Errorf("target not found in dependency graph: %s", params.Target)
 	}
 
-	return map[string]interface{}{
-		"target":       params.Target,
-		"dependencies": deps,
-		"graph": map[string]interface{}{
-			"directDependencies": node.Dependencies,
-			"dependents":         node.Dependents,
+	// Report the cycles reachable from the target, which the dependency
+	// list above only visits once
+	reachable := append([]string{params.Target}, deps...)
+	cycles := []*parser.Cycle{}
+	for _, cycle := range p.FindCycles() {
+		for _, name := range cycle.Targets {
+			if slices.Contains(reachable, name) {
+				cycles = append(cycles, cycle)
+				break
+			}
+		}
+	}
+
+	result := &getDependenciesResult{
+		Target:       params.Target,
+		Dependencies: deps,
+		Graph: dependencyNode{
+			DirectDependencies:    node.Dependencies,
+			OrderOnlyDependencies: node.OrderOnly,
+			GeneratedDependencies: node.Generated,
+			Dependents:            node.Dependents,
 		},
-	}, nil
+		Cycles: cycleInfos(cycles),
+	}
+	if params.FollowSubMakes {
+		result.SubMakes = subMakeInfos(subMakes)
+	}
+	return result, nil
+}
+
+// subMakeInfo describes a recursive make invocation
+type subMakeInfo struct {
+	Target    string   `json:"target"`
+	Command   string   `json:"command"`
+	Directory string   `json:"directory"`
+	File      string   `json:"file"`
+	Goals     []string `json:"goals"`
+	Makefile  string   `json:"makefile"`
+	Error     string   `json:"error,omitempty"`
 }
 
-func (s *Server) listVariables(args json.RawMessage) (interface{}, error) {
-	var params struct {
-		Path       string `json:"path,omitempty"`
-		IncludeEnv bool   `json:"include_env,omitempty"`
+func subMakeInfos(subMakes []*parser.SubMake) []subMakeInfo {
+	result := []subMakeInfo{}
+	for _, s := range subMakes {
+		result = append(result, subMakeInfo{
+			Target:    s.Target,
+			Command:   s.Command,
+			Directory: s.Directory,
+			File:      s.File,
+			Goals:     s.Goals,
+			Makefile:  s.Makefile,
+			Error:     s.Error,
+		})
 	}
-	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, err
+	return result
+}
+
+// cycleInfo describes a circular dependency
+type cycleInfo struct {
+	Targets  []string   `json:"targets"`
+	Edges    []edgeInfo `json:"edges"`
+	Dropped  []edgeInfo `json:"dropped" description:"Edges make drops to break the cycle"`
+	Messages []string   `json:"messages"`
+}
+
+func cycleInfos(cycles []*parser.Cycle) []cycleInfo {
+	result := []cycleInfo{}
+	for _, cycle := range cycles {
+		result = append(result, cycleInfo{
+			Targets:  cycle.Targets,
+			Edges:    edgeInfos(cycle.Edges),
+			Dropped:  edgeInfos(cycle.Dropped),
+			Messages: cycle.Messages(),
+		})
+	}
+	return result
+}
+
+// edgeInfo describes a dependency edge and the rule line forming it
+type edgeInfo struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	OrderOnly  bool   `json:"orderOnly"`
+	File       string `json:"file"`
+	LineNumber int    `json:"lineNumber"`
+}
+
+func edgeInfos(edges []*parser.DependencyEdge) []edgeInfo {
+	result := []edgeInfo{}
+	for _, e := range edges {
+		result = append(result, edgeInfo{
+			From:       e.From,
+			To:         e.To,
+			OrderOnly:  e.OrderOnly,
+			File:       e.File,
+			LineNumber: e.LineNumber,
+		})
 	}
+	return result
+}
+
+type listVariablesArgs struct {
+	Path       string `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	IncludeEnv bool   `json:"include_env,omitempty" description:"Include environment variables (default: false)"`
+}
+
+type listVariablesResult struct {
+	Variables []variableInfo `json:"variables"`
+}
+
+// variableInfo describes a variable assignment
+type variableInfo struct {
+	Name       string `json:"name"`
+	Target     string `json:"target,omitempty" description:"Target or pattern of a target- or pattern-specific assignment"`
+	Value      string `json:"value"`
+	Raw        string `json:"raw,omitempty"`
+	Type       string `json:"type"`
+	Flavor     string `json:"flavor"`
+	IsExported bool   `json:"isExported"`
+	IsOverride bool   `json:"isOverride,omitempty"`
+	IsPrivate  bool   `json:"isPrivate,omitempty"`
+	Multiline  bool   `json:"multiline,omitempty"`
+	File       string `json:"file,omitempty"`
+	LineNumber int    `json:"lineNumber" description:"Line of the assignment, -1 for the environment"`
+	Condition  string `json:"condition,omitempty"`
+}
 
+func (s *Server) listVariables(params listVariablesArgs) (*listVariablesResult, error) {
 	mf, err := s.getMakefile(params.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	variables := []map[string]interface{}{}
+	variables := []variableInfo{}
 	for name, variable := range mf.Variables {
-		varTypeStr := ""
-		switch variable.Type {
-		case parser.SimpleAssignment:
-			varTypeStr = "simple"
-		case parser.RecursiveAssignment:
-			varTypeStr = "recursive"
-		case parser.ConditionalAssignment:
-			varTypeStr = "conditional"
-		case parser.AppendAssignment:
-			varTypeStr = "append"
-		}
-
-		variables = append(variables, map[string]interface{}{
-			"name":       name,
-			"value":      variable.Value,
-			"type":       varTypeStr,
-			"isExported": variable.IsExported,
-			"lineNumber": variable.LineNumber,
+		variables = append(variables, variableInfo{
+			Name:       name,
+			Value:      variable.Value,
+			Raw:        variable.RawValue,
+			Type:       variable.Type.String(),
+			Flavor:     variable.Flavor.String(),
+			IsExported: variable.IsExported,
+			Multiline:  variable.IsMultiline,
+			File:       variable.File,
+			LineNumber: variable.LineNumber,
+			Condition:  conditionText(variable.Condition),
 		})
 	}
 
+	// Target- and pattern-specific assignments carry the target they apply to
+	scoped := append([]*parser.Variable{}, mf.PatternVariables...)
+	for _, vars := range mf.TargetVariables {
+		scoped = append(scoped, vars...)
+	}
+	variables = append(variables, targetVariableInfo(scoped, "")...)
+
 	// Include environment variables if requested
 	if params.IncludeEnv {
 		for _, env := range os.Environ() {
-			if idx := len(env); idx > 0 {
-				if pos := len(env); pos > 0 {
-					for i, c := range env {
-						if c == '=' {
-							name := env[:i]
-							value := env[i+1:]
-							variables = append(variables, map[string]interface{}{
-								"name":       name,
-								"value":      value,
-								"type":       "environment",
-								"isExported": true,
-								"lineNumber": -1,
-							})
-							break
-						}
-					}
-				}
+			if name, value, ok := strings.Cut(env, "="); ok && name != "" {
+				variables = append(variables, variableInfo{
+					Name:       name,
+					Value:      value,
+					Type:       "environment",
+					Flavor:     "recursive",
+					IsExported: true,
+					LineNumber: -1,
+				})
 			}
 		}
 	}
 
-	return map[string]interface{}{
-		"variables": variables,
-	}, nil
+	return &listVariablesResult{Variables: variables}, nil
+}
+
+type expandVariableArgs struct {
+	Variable string `json:"variable" description:"Variable name"`
+	Path     string `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	Target   string `json:"target,omitempty" description:"Expand as make would inside this target's recipe, applying target- and pattern-specific variables (optional)"`
+}
+
+type expandVariableResult struct {
+	Variable          string         `json:"variable"`
+	Original          string         `json:"original"`
+	Flavor            string         `json:"flavor"`
+	Expanded          string         `json:"expanded"`
+	Target            string         `json:"target,omitempty"`
+	TargetAssignments []variableInfo `json:"targetAssignments,omitempty"`
+}
+
+func (s *Server) expandVariable(params expandVariableArgs) (*expandVariableResult, error) {
+	p, err := s.getParser(params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded, err := p.ExpandTargetVariable(params.Variable, params.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &expandVariableResult{
+		Variable: params.Variable,
+		Flavor:   "environment",
+		Expanded: expanded,
+	}
+	if variable := p.Makefile().Variables[params.Variable]; variable != nil {
+		result.Original = variable.RawValue
+		result.Flavor = variable.Flavor.String()
+	}
+	if params.Target != "" {
+		result.Target = params.Target
+		result.TargetAssignments = targetVariableInfo(p.TargetSpecificVariables(params.Target), params.Variable)
+	}
+	return result, nil
 }
 
-func (s *Server) expandVariable(args json.RawMessage) (interface{}, error) {
-	var params struct {
-		Variable string `json:"variable"`
-		Path     string `json:"path,omitempty"`
+// targetVariableInfo describes target- and pattern-specific assignments,
+// limited to one variable unless name is empty
+func targetVariableInfo(variables []*parser.Variable, name string) []variableInfo {
+	result := []variableInfo{}
+	for _, v := range variables {
+		if name != "" && v.Name != name {
+			continue
+		}
+		result = append(result, variableInfo{
+			Name:       v.Name,
+			Target:     v.Target,
+			Value:      v.Value,
+			Raw:        v.RawValue,
+			Type:       v.Type.String(),
+			Flavor:     v.Flavor.String(),
+			IsExported: v.IsExported,
+			IsOverride: v.IsOverride,
+			IsPrivate:  v.IsPrivate,
+			File:       v.File,
+			LineNumber: v.LineNumber,
+		})
 	}
-	if err := json.Unmarshal(args, &params); err != nil {
+	return result
+}
+
+type findMakefilesArgs struct {
+	Root    string `json:"root,omitempty" description:"Root directory to search (optional, defaults to current directory)"`
+	Pattern string `json:"pattern,omitempty" description:"File pattern to match (optional, defaults to common Makefile names)"`
+}
+
+type findMakefilesResult struct {
+	Makefiles []makefileInfo `json:"makefiles"`
+	Count     int            `json:"count"`
+}
+
+type makefileInfo struct {
+	Path     string `json:"path"`
+	Relative string `json:"relative" description:"Path relative to the current directory"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+}
+
+func (s *Server) findMakefiles(params findMakefilesArgs) (*findMakefilesResult, error) {
+	if params.Root == "" {
+		params.Root = "."
+	}
+
+	makefiles, err := parser.FindMakefiles(params.Root, params.Pattern)
+	if err != nil {
 		return nil, err
 	}
 
+	// Convert to relative paths
+	cwd, _ := os.Getwd()
+	results := []makefileInfo{}
+	for _, path := range makefiles {
+		relPath, _ := filepath.Rel(cwd, path)
+		info, _ := os.Stat(path)
+		results = append(results, makefileInfo{
+			Path:     path,
+			Relative: relPath,
+			Size:     info.Size(),
+			Modified: info.ModTime().Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return &findMakefilesResult{
+		Makefiles: results,
+		Count:     len(results),
+	}, nil
+}
+
+type getDiagnosticsArgs struct {
+	Path     string `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	Severity string `json:"severity,omitempty" enum:"error,warning" description:"Only report diagnostics of this severity (optional)"`
+}
+
+type getDiagnosticsResult struct {
+	Diagnostics []diagnosticInfo `json:"diagnostics"`
+	Errors      int              `json:"errors"`
+	Warnings    int              `json:"warnings"`
+	Files       []string         `json:"files" description:"Every file read, the Makefile first"`
+}
+
+func (s *Server) getDiagnostics(params getDiagnosticsArgs) (*getDiagnosticsResult, error) {
 	mf, err := s.getMakefile(params.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update parser's makefile reference
-	s.parser = parser.NewParser()
-	s.parser.ParseFile(mf.Path)
+	diagnostics := []*parser.Diagnostic{}
+	errors, warnings := 0, 0
+	for _, d := range mf.Diagnostics {
+		if params.Severity != "" && d.Severity.String() != params.Severity {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+		if d.Severity == parser.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	return &getDiagnosticsResult{
+		Diagnostics: diagnosticInfos(diagnostics),
+		Errors:      errors,
+		Warnings:    warnings,
+		Files:       mf.Files,
+	}, nil
+}
+
+type findCyclesArgs struct {
+	Path string `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+}
+
+type findCyclesResult struct {
+	Cycles []cycleInfo `json:"cycles"`
+	Count  int         `json:"count"`
+}
+
+func (s *Server) findCycles(params findCyclesArgs) (*findCyclesResult, error) {
+	p, err := s.getParser(params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	cycles := p.FindCycles()
+	return &findCyclesResult{
+		Cycles: cycleInfos(cycles),
+		Count:  len(cycles),
+	}, nil
+}
+
+type renderGraphArgs struct {
+	Path          string   `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	Format        string   `json:"format,omitempty" description:"Output format (default: mermaid)"`
+	Targets       []string `json:"targets,omitempty" description:"Render only these targets and what they depend on (optional, defaults to the whole graph)"`
+	CollapseFiles bool     `json:"collapse_files,omitempty" description:"Hide file targets and prerequisites, linking phony targets through them (default: false)"`
+	HideOrderOnly bool     `json:"hide_order_only,omitempty" description:"Leave out order-only prerequisites (default: false)"`
+	ColorPhony    bool     `json:"color_phony,omitempty" description:"Highlight phony targets (default: false)"`
+	ClusterByFile bool     `json:"cluster_by_file,omitempty" description:"Group targets by the file that defines them (default: false)"`
+}
+
+type renderGraphResult struct {
+	Format string `json:"format"`
+	Output string `json:"output"`
+	Nodes  int    `json:"nodes"`
+	Edges  int    `json:"edges"`
+}
+
+func (s *Server) renderGraph(params renderGraphArgs) (*renderGraphResult, error) {
+	if params.Format == "" {
+		params.Format = "mermaid"
+	}
 
-	expanded, err := s.parser.ExpandVariable(params.Variable)
+	p, err := s.getParser(params.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	variable := mf.Variables[params.Variable]
-	original := ""
-	if variable != nil {
-		original = variable.Value
+	output, g, err := graph.Render(p, params.Format, graph.Options{
+		Roots:         params.Targets,
+		CollapseFiles: params.CollapseFiles,
+		HideOrderOnly: params.HideOrderOnly,
+		ColorPhony:    params.ColorPhony,
+		ClusterByFile: params.ClusterByFile,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return map[string]interface{}{
-		"variable": params.Variable,
-		"original": original,
-		"expanded": expanded,
+	return &renderGraphResult{
+		Format: params.Format,
+		Output: output,
+		Nodes:  len(g.Nodes),
+		Edges:  len(g.Edges),
 	}, nil
 }
 
-func (s *Server) findMakefiles(args json.RawMessage) (interface{}, error) {
-	var params struct {
-		Root    string `json:"root,omitempty"`
-		Pattern string `json:"pattern,omitempty"`
+type planBuildArgs struct {
+	Path  string   `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	Goals []string `json:"goals,omitempty" description:"Goals to update (optional, defaults to the default goal)"`
+}
+
+type planBuildResult struct {
+	Goals       []string   `json:"goals"`
+	Steps       []planStep `json:"steps" description:"Targets in the order make finishes them"`
+	Layers      [][]string `json:"layers" description:"Targets that can be updated in parallel, layer by layer"`
+	Sources     []string   `json:"sources" description:"Prerequisites without a rule that exist"`
+	Missing     []string   `json:"missing" description:"Prerequisites without a rule that don't exist"`
+	Dropped     []edgeInfo `json:"dropped" description:"Circular dependencies make drops"`
+	Messages    []string   `json:"messages"`
+	NotParallel bool       `json:"notParallel"`
+}
+
+type planStep struct {
+	Target                string            `json:"target"`
+	Dependencies          []string          `json:"dependencies"`
+	OrderOnlyDependencies []string          `json:"orderOnlyDependencies"`
+	IsPhony               bool              `json:"isPhony"`
+	Commands              []string          `json:"commands"`
+	Layer                 int               `json:"layer"`
+	ImplicitRule          *implicitRuleInfo `json:"implicitRule,omitempty"`
+}
+
+func (s *Server) planBuild(params planBuildArgs) (*planBuildResult, error) {
+	p, err := s.getParser(params.Path)
+	if err != nil {
+		return nil, err
 	}
-	if err := json.Unmarshal(args, &params); err != nil {
+
+	plan, err := p.PlanBuild(params.Goals)
+	if err != nil {
 		return nil, err
 	}
 
-	if params.Root == "" {
-		params.Root = "."
+	steps := []planStep{}
+	for _, step := range plan.Steps {
+		info := planStep{
+			Target:                step.Target,
+			Dependencies:          step.Prerequisites,
+			OrderOnlyDependencies: step.OrderOnly,
+			IsPhony:               step.Phony,
+			Commands:              step.Commands,
+			Layer:                 step.Layer,
+		}
+		if step.Implicit != nil {
+			info.ImplicitRule = newImplicitRuleInfo(step.Implicit)
+		}
+		steps = append(steps, info)
+	}
+	messages := []string{}
+	for _, e := range plan.Dropped {
+		messages = append(messages, e.DroppedMessage())
 	}
 
-	makefiles, err := parser.FindMakefiles(params.Root, params.Pattern)
+	return &planBuildResult{
+		Goals:       plan.Goals,
+		Steps:       steps,
+		Layers:      plan.Layers,
+		Sources:     plan.Sources,
+		Missing:     plan.Missing,
+		Dropped:     edgeInfos(plan.Dropped),
+		Messages:    messages,
+		NotParallel: plan.NotParallel,
+	}, nil
+}
+
+type checkStaleArgs struct {
+	Path  string   `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	Goals []string `json:"goals,omitempty" description:"Goals to check (optional, defaults to the default goal)"`
+}
+
+type checkStaleResult struct {
+	Goals    []string        `json:"goals"`
+	Targets  []stalenessInfo `json:"targets"`
+	Rebuild  []string        `json:"rebuild"`
+	UpToDate []string        `json:"upToDate"`
+	Failed   []string        `json:"failed"`
+}
+
+type stalenessInfo struct {
+	Target  string   `json:"target"`
+	Exists  bool     `json:"exists"`
+	ModTime string   `json:"modTime,omitempty"`
+	Rebuild bool     `json:"rebuild"`
+	Reasons []string `json:"reasons"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (s *Server) checkStale(params checkStaleArgs) (*checkStaleResult, error) {
+	p, err := s.getParser(params.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert to relative paths
-	cwd, _ := os.Getwd()
-	results := []map[string]interface{}{}
-	for _, path := range makefiles {
-		relPath, _ := filepath.Rel(cwd, path)
-		info, _ := os.Stat(path)
-		results = append(results, map[string]interface{}{
-			"path":     path,
-			"relative": relPath,
-			"size":     info.Size(),
-			"modified": info.ModTime().Format("2006-01-02 15:04:05"),
+	staleness, plan, err := p.CheckStale(params.Goals)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &checkStaleResult{
+		Goals:    plan.Goals,
+		Targets:  []stalenessInfo{},
+		Rebuild:  []string{},
+		UpToDate: []string{},
+		Failed:   []string{},
+	}
+	for _, st := range staleness {
+		info := stalenessInfo{
+			Target:  st.Target,
+			Exists:  st.Exists,
+			Rebuild: st.Rebuild,
+			Reasons: st.Reasons,
+			Error:   st.Error,
+		}
+		if st.Exists {
+			info.ModTime = st.ModTime.Format(time.RFC3339Nano)
+		}
+		result.Targets = append(result.Targets, info)
+
+		switch {
+		case st.Error != "":
+			result.Failed = append(result.Failed, st.Target)
+		case st.Rebuild:
+			result.Rebuild = append(result.Rebuild, st.Target)
+		default:
+			result.UpToDate = append(result.UpToDate, st.Target)
+		}
+	}
+	return result, nil
+}
+
+type affectedTargetsArgs struct {
+	Files []string `json:"files" description:"Changed files, relative to the Makefile's directory or absolute"`
+	Path  string   `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+}
+
+type affectedTargetsResult struct {
+	Changed   []string     `json:"changed"`
+	Affected  []impactInfo `json:"affected"`
+	Targets   []string     `json:"targets"`
+	Unused    []string     `json:"unused" description:"Changed files no target depends on"`
+	Makefiles []string     `json:"makefiles" description:"Changed files read as part of the Makefile"`
+}
+
+type impactInfo struct {
+	Target  string   `json:"target"`
+	IsPhony bool     `json:"isPhony"`
+	Changed []string `json:"changed" description:"Changed files the target depends on"`
+}
+
+func (s *Server) affectedTargets(params affectedTargetsArgs) (*affectedTargetsResult, error) {
+	p, err := s.getParser(params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := p.AffectedTargets(params.Files)
+	affected := []impactInfo{}
+	targets := []string{}
+	for _, impact := range report.Targets {
+		affected = append(affected, impactInfo{
+			Target:  impact.Target,
+			IsPhony: impact.Phony,
+			Changed: impact.Changed,
 		})
+		targets = append(targets, impact.Target)
 	}
 
-	return map[string]interface{}{
-		"makefiles": results,
-		"count":     len(results),
+	return &affectedTargetsResult{
+		Changed:   report.Changed,
+		Affected:  affected,
+		Targets:   targets,
+		Unused:    report.Unused,
+		Makefiles: report.Makefiles,
+	}, nil
+}
+
+type lintMakefileArgs struct {
+	Path     string            `json:"path,omitempty" description:"Path to the Makefile (optional)"`
+	Enable   []string          `json:"enable,omitempty" description:"Run only these rules (optional, defaults to all rules)"`
+	Disable  []string          `json:"disable,omitempty" description:"Rules not to run (optional)"`
+	Severity map[string]string `json:"severity,omitempty" enum:"error,warning,info" description:"Severity overrides by rule ID, e.g. {\"missing-description\": \"error\"} (optional)"`
+}
+
+type lintMakefileResult struct {
+	Findings []findingInfo `json:"findings"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+	Infos    int           `json:"infos"`
+}
+
+type findingInfo struct {
+	Rule       string    `json:"rule"`
+	Severity   string    `json:"severity"`
+	File       string    `json:"file"`
+	LineNumber int       `json:"lineNumber"`
+	Range      rangeInfo `json:"range"`
+	Message    string    `json:"message"`
+	Text       string    `json:"text"`
+}
+
+func (s *Server) lintMakefile(params lintMakefileArgs) (*lintMakefileResult, error) {
+	config := lint.Config{
+		Enable:     params.Enable,
+		Disable:    params.Disable,
+		Severities: make(map[string]lint.Severity),
+	}
+	for rule, name := range params.Severity {
+		severity, err := lint.ParseSeverity(name)
+		if err != nil {
+			return nil, err
+		}
+		config.Severities[rule] = severity
+	}
+
+	p, err := s.getParser(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	findings, err := lint.Run(p, config)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{"error": 0, "warning": 0, "info": 0}
+	results := []findingInfo{}
+	for _, f := range findings {
+		counts[f.Severity.String()]++
+		results = append(results, findingInfo{
+			Rule:       f.Rule,
+			Severity:   f.Severity.String(),
+			File:       f.File,
+			LineNumber: f.Range.Start.Line,
+			Range:      newRangeInfo(f.Range),
+			Message:    f.Message,
+			Text:       f.String(),
+		})
+	}
+
+	return &lintMakefileResult{
+		Findings: results,
+		Errors:   counts["error"],
+		Warnings: counts["warning"],
+		Infos:    counts["info"],
 	}, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,220 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseConditional handles ifeq/ifneq/ifdef/ifndef/else/endif directives.
+// It reports whether the line was a conditional directive. Malformed
+// directives are diagnosed and read as make would read the nearest valid
+// one, so that the blocks stay balanced.
+func (p *Parser) parseConditional(line string, lineNumber int) bool {
+	line = stripComment(line)
+
+	if matches := ifRegex.FindStringSubmatch(line); matches != nil {
+		kind := conditionalKinds[matches[1]]
+		cond := strings.TrimSpace(strings.TrimPrefix(line, matches[1]))
+		block := &Conditional{
+			Parent:     p.currentBranch(),
+			LineNumber: lineNumber,
+		}
+		if block.Parent != nil {
+			block.Parent.Nested = append(block.Parent.Nested, block)
+		} else {
+			p.makefile.Conditionals = append(p.makefile.Conditionals, block)
+		}
+		branch := &ConditionalBranch{
+			Kind:        kind,
+			Condition:   cond,
+			LineNumber:  lineNumber,
+			Conditional: block,
+		}
+		// The condition is evaluated before the block opens, so that
+		// $(eval ...) in it reads its text where the directive appears
+		if p.active() {
+			ok, err := p.evalCondition(kind, cond)
+			if err != nil {
+				p.report(SeverityError, "invalid-conditional", p.file, p.lineRange(p.file, lineNumber), "%v", err)
+			}
+			branch.Active = ok
+		}
+		block.Branches = append(block.Branches, branch)
+		p.conds = append(p.conds, block)
+		return true
+	}
+
+	if matches := elseRegex.FindStringSubmatch(line); matches != nil {
+		if len(p.conds) == p.condBase {
+			p.report(SeverityError, "extraneous-else", p.file, p.lineRange(p.file, lineNumber), "extraneous 'else'")
+			return true
+		}
+		block := p.conds[len(p.conds)-1]
+		last := block.Branches[len(block.Branches)-1]
+		// Lines after a second else are never read
+		duplicate := last.Kind == Else
+		if duplicate {
+			p.report(SeverityError, "duplicate-else", p.file, p.lineRange(p.file, lineNumber), "only one 'else' per conditional")
+		}
+
+		branch := &ConditionalBranch{
+			Kind:        Else,
+			LineNumber:  lineNumber,
+			Conditional: block,
+		}
+		if rest := strings.TrimSpace(matches[1]); rest != "" {
+			// "else ifeq (...)" continues the chain with another condition
+			if m := ifRegex.FindStringSubmatch(rest); m != nil {
+				branch.Kind = conditionalKinds[m[1]]
+				branch.Condition = strings.TrimSpace(strings.TrimPrefix(rest, m[1]))
+			} else {
+				p.report(SeverityWarning, "extraneous-text", p.file, p.lineRange(p.file, lineNumber), "extraneous text after 'else' directive")
+			}
+		}
+
+		taken := false
+		for _, b := range block.Branches {
+			taken = taken || b.Active
+		}
+		parentActive := block.Parent == nil || block.Parent.Active
+		if parentActive && !taken && !duplicate {
+			ok := true
+			if branch.Kind != Else {
+				// As for ifeq, the condition is evaluated outside the block
+				var err error
+				p.conds = p.conds[:len(p.conds)-1]
+				ok, err = p.evalCondition(branch.Kind, branch.Condition)
+				p.conds = append(p.conds, block)
+				if err != nil {
+					p.report(SeverityError, "invalid-conditional", p.file, p.lineRange(p.file, lineNumber), "%v", err)
+				}
+			}
+			branch.Active = ok
+		}
+		block.Branches = append(block.Branches, branch)
+		return true
+	}
+
+	if endifRegex.MatchString(line) {
+		if len(p.conds) == p.condBase {
+			p.report(SeverityError, "extraneous-endif", p.file, p.lineRange(p.file, lineNumber), "extraneous 'endif'")
+			return true
+		}
+		if line != "endif" {
+			p.report(SeverityWarning, "extraneous-text", p.file, p.lineRange(p.file, lineNumber), "extraneous text after 'endif' directive")
+		}
+		p.conds[len(p.conds)-1].EndLine = lineNumber
+		p.conds = p.conds[:len(p.conds)-1]
+		return true
+	}
+
+	return false
+}
+
+var conditionalKinds = map[string]ConditionalKind{
+	"ifeq":   IfEq,
+	"ifneq":  IfNeq,
+	"ifdef":  IfDef,
+	"ifndef": IfNdef,
+}
+
+// currentBranch returns the innermost open conditional branch, or nil at top level
+func (p *Parser) currentBranch() *ConditionalBranch {
+	if len(p.conds) == 0 {
+		return nil
+	}
+	block := p.conds[len(p.conds)-1]
+	return block.Branches[len(block.Branches)-1]
+}
+
+// active reports whether make would read lines at the current position
+func (p *Parser) active() bool {
+	branch := p.currentBranch()
+	return branch == nil || branch.Active
+}
+
+// evalCondition evaluates a conditional directive against the variables
+// defined so far, as make does while reading the Makefile
+func (p *Parser) evalCondition(kind ConditionalKind, cond string) (bool, error) {
+	switch kind {
+	case IfDef, IfNdef:
+		name := strings.TrimSpace(p.expandText(cond))
+		defined := false
+		if v, ok := p.makefile.Variables[name]; ok {
+			defined = v.Value != ""
+		} else {
+			defined = os.Getenv(name) != ""
+		}
+		return defined == (kind == IfDef), nil
+	case IfEq, IfNeq:
+		a, b, err := splitConditionArgs(cond)
+		if err != nil {
+			return false, err
+		}
+		a = strings.TrimSpace(p.expandText(a))
+		b = strings.TrimSpace(p.expandText(b))
+		return (a == b) == (kind == IfEq), nil
+	}
+	return false, fmt.Errorf("invalid conditional: %s", kind)
+}
+
+// splitConditionArgs splits the arguments of ifeq/ifneq, which may be
+// written as (a,b), "a" "b", 'a' 'b' or any mix of quotes
+func splitConditionArgs(cond string) (string, string, error) {
+	if strings.HasPrefix(cond, "(") {
+		depth := 0
+		comma := -1
+		for i, c := range cond {
+			switch c {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					if comma < 0 || strings.TrimSpace(cond[i+1:]) != "" {
+						return "", "", fmt.Errorf("invalid syntax in conditional")
+					}
+					return cond[1:comma], cond[comma+1 : i], nil
+				}
+			case ',':
+				if depth == 1 && comma < 0 {
+					comma = i
+				}
+			}
+		}
+		return "", "", fmt.Errorf("invalid syntax in conditional")
+	}
+
+	var args []string
+	rest := cond
+	for len(args) < 2 {
+		rest = strings.TrimSpace(rest)
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			return "", "", fmt.Errorf("invalid syntax in conditional")
+		}
+		end := strings.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return "", "", fmt.Errorf("invalid syntax in conditional")
+		}
+		args = append(args, rest[1:end+1])
+		rest = rest[end+2:]
+	}
+	if strings.TrimSpace(rest) != "" {
+		return "", "", fmt.Errorf("extraneous text after conditional")
+	}
+	return args[0], args[1], nil
+}
+
+// stripComment removes a trailing comment and unescapes '\#' as make does.
+// Blanks before the comment are kept, as they are part of a variable's
+// value.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+			break
+		}
+	}
+	return strings.ReplaceAll(line, `\#`, "#")
+}
@@ -0,0 +1,645 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// directiveRegex matches directives that take a list of names
+var directiveRegex = regexp.MustCompile(`^(export|unexport|vpath)(\s|$)`)
+
+// Position is a location in a source file. Line and Column start at 1,
+// Column counts bytes and Offset is the 0-based byte offset.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Range is the span of source text covered by a syntax node. End is the
+// position just after the last byte of the node.
+type Range struct {
+	Start Position
+	End   Position
+}
+
+// NodeKind represents the kind of a syntax node
+type NodeKind int
+
+const (
+	// Statements, the top-level nodes of a syntax tree
+	BlankNode      NodeKind = iota // Empty or whitespace-only line
+	CommentNode                    // Comment line, or a trailing comment within a statement
+	RuleNode                       // targets: prerequisites
+	RecipeNode                     // Recipe line, or an inline recipe after ';'
+	AssignmentNode                 // Variable assignment, including target-specific ones
+	DirectiveNode                  // Conditionals, include, export, undefine, vpath
+	DefineNode                     // define ... endef, including the body
+	TextNode                       // Any other line such as $(eval ...), or a line of a define body
+
+	// Tokens within statements
+	KeywordNode       // Directive keyword or assignment prefix, e.g. "ifeq", "override"
+	TargetNode        // Target of a rule or a target-specific assignment
+	TargetPatternNode // Target pattern of a static pattern rule, e.g. "%.o"
+	PrerequisiteNode  // Normal prerequisite
+	OrderOnlyNode     // Prerequisite after '|'
+	OperatorNode      // ':', '::', '&:', '|', ';' or an assignment operator
+	NameNode          // Variable name
+	ValueNode         // Variable value as written
+	ArgumentNode      // Directive argument, e.g. an included file or a condition
+)
+
+// String returns the name of the node kind
+func (k NodeKind) String() string {
+	switch k {
+	case BlankNode:
+		return "blank"
+	case CommentNode:
+		return "comment"
+	case RuleNode:
+		return "rule"
+	case RecipeNode:
+		return "recipe"
+	case AssignmentNode:
+		return "assignment"
+	case DirectiveNode:
+		return "directive"
+	case DefineNode:
+		return "define"
+	case TextNode:
+		return "text"
+	case KeywordNode:
+		return "keyword"
+	case TargetNode:
+		return "target"
+	case TargetPatternNode:
+		return "target-pattern"
+	case PrerequisiteNode:
+		return "prerequisite"
+	case OrderOnlyNode:
+		return "order-only"
+	case OperatorNode:
+		return "operator"
+	case NameNode:
+		return "name"
+	case ValueNode:
+		return "value"
+	case ArgumentNode:
+		return "argument"
+	}
+	return "unknown"
+}
+
+// Node is a node of the concrete syntax tree. Statements cover whole
+// logical lines, continuations included; their tokens are children.
+type Node struct {
+	Kind     NodeKind
+	Range    Range
+	Text     string // Source text of the node, byte for byte
+	EOL      string // Line terminator after a statement: "\n", "\r\n" or "" at end of file
+	Children []*Node
+}
+
+// SyntaxTree is a lossless concrete syntax tree of one Makefile. Joining
+// the text and line terminators of its statements reproduces the source.
+type SyntaxTree struct {
+	File  string
+	Nodes []*Node // Statements in source order
+}
+
+// String returns the source the tree was parsed from
+func (t *SyntaxTree) String() string {
+	var b strings.Builder
+	for _, n := range t.Nodes {
+		b.WriteString(n.Text)
+		b.WriteString(n.EOL)
+	}
+	return b.String()
+}
+
+// Walk calls fn for every node depth-first in source order. Children of
+// a node are skipped when fn returns false.
+func (t *SyntaxTree) Walk(fn func(*Node) bool) {
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, n := range nodes {
+			if fn(n) {
+				walk(n.Children)
+			}
+		}
+	}
+	walk(t.Nodes)
+}
+
+// NodeAt returns the innermost node covering the given line and column,
+// or nil if no node does
+func (t *SyntaxTree) NodeAt(line, column int) *Node {
+	var found *Node
+	t.Walk(func(n *Node) bool {
+		start, end := n.Range.Start, n.Range.End
+		if comparePosition(line, column, start) < 0 || comparePosition(line, column, end) >= 0 {
+			return false
+		}
+		found = n
+		return true
+	})
+	return found
+}
+
+// Statement returns the source text of the statement starting at line,
+// without its final line terminator. The text of a rule includes its
+// recipe and any comments or blank lines between recipe lines.
+func (t *SyntaxTree) Statement(line int) (string, bool) {
+	for i, n := range t.Nodes {
+		if n.Range.Start.Line != line || n.Kind == BlankNode {
+			continue
+		}
+		nodes := []*Node{n}
+		if n.Kind == RuleNode {
+			pending := []*Node{}
+			for _, next := range t.Nodes[i+1:] {
+				if next.Kind == BlankNode || next.Kind == CommentNode {
+					pending = append(pending, next)
+					continue
+				}
+				if next.Kind != RecipeNode {
+					break
+				}
+				nodes = append(append(nodes, pending...), next)
+				pending = pending[:0]
+			}
+		}
+		var b strings.Builder
+		for j, node := range nodes {
+			b.WriteString(node.Text)
+			if j < len(nodes)-1 {
+				b.WriteString(node.EOL)
+			}
+		}
+		return b.String(), true
+	}
+	return "", false
+}
+
+// comparePosition compares line and column with pos
+func comparePosition(line, column int, pos Position) int {
+	if line != pos.Line {
+		return line - pos.Line
+	}
+	return column - pos.Column
+}
+
+// ParseSyntaxFile reads a Makefile into a concrete syntax tree. Included
+// files are not followed.
+func ParseSyntaxFile(path string) (*SyntaxTree, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	tree := ParseSyntax(src)
+	tree.File = path
+	return tree, nil
+}
+
+// ParseSyntax builds the concrete syntax tree of Makefile source. It never
+// fails: text it doesn't recognize becomes a text node.
+func ParseSyntax(src []byte) *SyntaxTree {
+	s := newSyntaxScanner(src)
+	tree := &SyntaxTree{Nodes: []*Node{}}
+	for pos := 0; pos < len(s.src); {
+		var node *Node
+		node, pos = s.statement(pos)
+		tree.Nodes = append(tree.Nodes, node)
+	}
+	return tree
+}
+
+// syntaxScanner splits source into statements and tokens
+type syntaxScanner struct {
+	src        string
+	lineStarts []int // Offset of the first byte of each line
+	inRecipe   bool  // Lines starting with a tab are recipe lines
+}
+
+// newSyntaxScanner creates a scanner over src with its line offsets
+func newSyntaxScanner(src []byte) *syntaxScanner {
+	s := &syntaxScanner{src: string(src), lineStarts: []int{0}}
+	for i := 0; i < len(s.src); i++ {
+		if s.src[i] == '\n' {
+			s.lineStarts = append(s.lineStarts, i+1)
+		}
+	}
+	return s
+}
+
+// statement reads the statement starting at pos and returns it with the
+// offset of the next one
+func (s *syntaxScanner) statement(pos int) (*Node, int) {
+	end, next := s.logicalEnd(pos)
+	// Continuations become blanks, so offsets in text are offsets in the source
+	text := s.cook(pos, end)
+	trimmed := strings.TrimSpace(text)
+
+	var node *Node
+	switch {
+	case s.inRecipe && strings.HasPrefix(text, "\t"):
+		node = s.node(RecipeNode, pos, end)
+	case trimmed == "":
+		node = s.node(BlankNode, pos, end)
+	case trimmed[0] == '#':
+		node = s.node(CommentNode, pos, end)
+	case ifRegex.MatchString(trimmed) || elseRegex.MatchString(trimmed) || endifRegex.MatchString(trimmed):
+		// Conditionals may appear between recipe lines
+		node = s.directive(pos, end, text)
+	case defineRegex.MatchString(stripComment(trimmed)):
+		node, end, next = s.define(pos, end, next, text)
+		s.inRecipe = false
+	default:
+		node = s.simpleStatement(pos, end, text)
+	}
+	node.EOL = s.src[end:next]
+	return node, next
+}
+
+// simpleStatement classifies a logical line that is not a recipe line,
+// comment or conditional, in the order the parser does
+func (s *syntaxScanner) simpleStatement(pos, end int, text string) *Node {
+	content := text
+	if c := commentIndex(text, 0); c >= 0 {
+		content = text[:c]
+	}
+	trimmed := strings.TrimSpace(content)
+	s.inRecipe = false
+
+	switch {
+	case undefineRegex.MatchString(trimmed), includeRegex.MatchString(trimmed):
+		return s.directive(pos, end, text)
+	case variableRegex.MatchString(trimmed):
+		node := s.node(AssignmentNode, pos, end)
+		s.assignment(node, pos, text, 0)
+		return node
+	case directiveRegex.MatchString(trimmed):
+		return s.directive(pos, end, text)
+	}
+
+	if colon := indexUnquoted(content, ':'); colon >= 0 {
+		rest := content[colon+1:]
+		if variableRegex.MatchString(strings.TrimSpace(rest)) && !strings.HasPrefix(rest, "=") {
+			node := s.node(AssignmentNode, pos, end)
+			for _, f := range fields(text, 0, colon) {
+				s.add(node, TargetNode, pos, f[0], f[1])
+			}
+			s.add(node, OperatorNode, pos, colon, colon+1)
+			s.assignment(node, pos, text, colon+1)
+			return node
+		}
+		if !strings.HasPrefix(rest, "=") {
+			s.inRecipe = true
+			return s.rule(pos, end, text, colon)
+		}
+	}
+	return s.node(TextNode, pos, end)
+}
+
+// rule tokenizes a rule line whose first colon is at colon
+func (s *syntaxScanner) rule(pos, end int, text string, colon int) *Node {
+	node := s.node(RuleNode, pos, end)
+
+	// An inline recipe after ';' may contain '#', a comment before it hides it
+	contentEnd := len(text)
+	comment := commentIndex(text, 0)
+	semicolon := indexUnquoted(text[colon:], ';')
+	if semicolon >= 0 {
+		semicolon += colon
+	}
+	if semicolon >= 0 && (comment < 0 || semicolon < comment) {
+		contentEnd, comment = semicolon, -1
+	} else {
+		semicolon = -1
+		if comment >= 0 {
+			contentEnd = comment
+		}
+	}
+
+	opStart, opEnd := colon, colon+1
+	if colon > 0 && text[colon-1] == '&' {
+		opStart--
+	}
+	if opEnd < contentEnd && text[opEnd] == ':' {
+		opEnd++
+	}
+	for _, f := range fields(text, 0, opStart) {
+		s.add(node, TargetNode, pos, f[0], f[1])
+	}
+	s.add(node, OperatorNode, pos, opStart, opEnd)
+
+	rest := opEnd
+	if second := indexUnquoted(text[rest:contentEnd], ':'); second >= 0 {
+		second += rest
+		for _, f := range fields(text, rest, second) {
+			s.add(node, TargetPatternNode, pos, f[0], f[1])
+		}
+		s.add(node, OperatorNode, pos, second, second+1)
+		rest = second + 1
+	}
+
+	normalEnd := contentEnd
+	bar := indexUnquoted(text[rest:contentEnd], '|')
+	if bar >= 0 {
+		normalEnd = rest + bar
+	}
+	for _, f := range fields(text, rest, normalEnd) {
+		s.add(node, PrerequisiteNode, pos, f[0], f[1])
+	}
+	if bar >= 0 {
+		s.add(node, OperatorNode, pos, normalEnd, normalEnd+1)
+		for _, f := range fields(text, normalEnd+1, contentEnd) {
+			s.add(node, OrderOnlyNode, pos, f[0], f[1])
+		}
+	}
+
+	if semicolon >= 0 {
+		s.add(node, OperatorNode, pos, semicolon, semicolon+1)
+		if a, b := trimSpan(text, semicolon+1, len(text)); a < b {
+			s.add(node, RecipeNode, pos, a, b)
+		}
+	}
+	s.addComment(node, pos, text, comment)
+	return node
+}
+
+// assignment tokenizes the variable assignment starting at from
+func (s *syntaxScanner) assignment(node *Node, pos int, text string, from int) {
+	contentEnd := len(text)
+	comment := commentIndex(text, from)
+	if comment >= 0 {
+		contentEnd = comment
+	}
+	lead, _ := trimSpan(text, from, contentEnd)
+	m := variableRegex.FindStringSubmatchIndex(text[lead:contentEnd])
+	if m == nil {
+		return
+	}
+	for _, f := range fields(text, lead+m[2], lead+m[3]) {
+		s.add(node, KeywordNode, pos, f[0], f[1])
+	}
+	if a, b := trimSpan(text, lead+m[4], lead+m[5]); a < b {
+		s.add(node, NameNode, pos, a, b)
+	}
+	s.add(node, OperatorNode, pos, lead+m[6], lead+m[7])
+	if a, b := trimSpan(text, lead+m[8], lead+m[9]); a < b {
+		s.add(node, ValueNode, pos, a, b)
+	}
+	s.addComment(node, pos, text, comment)
+}
+
+// directiveKeywords are the words that start a directive
+var directiveKeywords = map[string]bool{
+	"ifeq": true, "ifneq": true, "ifdef": true, "ifndef": true, "else": true, "endif": true,
+	"include": true, "-include": true, "sinclude": true,
+	"export": true, "unexport": true, "override": true, "undefine": true, "vpath": true,
+}
+
+// directive tokenizes a directive line
+func (s *syntaxScanner) directive(pos, end int, text string) *Node {
+	node := s.node(DirectiveNode, pos, end)
+	contentEnd := len(text)
+	comment := commentIndex(text, 0)
+	if comment >= 0 {
+		contentEnd = comment
+	}
+
+	words := fields(text, 0, contentEnd)
+	i := 0
+	for i < len(words) && directiveKeywords[text[words[i][0]:words[i][1]]] {
+		s.add(node, KeywordNode, pos, words[i][0], words[i][1])
+		i++
+	}
+	if i > 0 && i < len(words) {
+		// A condition such as "($(CC), gcc)" is a single argument
+		if strings.HasPrefix(text[words[i-1][0]:words[i-1][1]], "if") {
+			a, b := trimSpan(text, words[i][0], contentEnd)
+			s.add(node, ArgumentNode, pos, a, b)
+		} else {
+			for _, w := range words[i:] {
+				s.add(node, ArgumentNode, pos, w[0], w[1])
+			}
+		}
+	}
+	s.addComment(node, pos, text, comment)
+	return node
+}
+
+// define reads a define ... endef block. It returns the node with the end
+// of its text and the offset of the next statement.
+func (s *syntaxScanner) define(pos, end, next int, text string) (*Node, int, int) {
+	var children []*Node
+	header := &Node{}
+	contentEnd := len(text)
+	comment := commentIndex(text, 0)
+	if comment >= 0 {
+		contentEnd = comment
+	}
+	lead, trail := trimSpan(text, 0, contentEnd)
+	if m := defineRegex.FindStringSubmatchIndex(text[lead:trail]); m != nil {
+		for _, f := range fields(text, lead+m[2], lead+m[3]) {
+			s.add(header, KeywordNode, pos, f[0], f[1])
+		}
+		s.add(header, KeywordNode, pos, lead+m[3], lead+m[3]+len("define"))
+		s.add(header, NameNode, pos, lead+m[4], lead+m[5])
+		if m[6] >= 0 {
+			s.add(header, OperatorNode, pos, lead+m[6], lead+m[7])
+		}
+	}
+	s.addComment(header, pos, text, comment)
+	children = append(children, header.Children...)
+
+	// The body is read line by line up to the matching endef
+	depth := 0
+	for p := next; p < len(s.src); {
+		lineEnd, lineNext := s.lineEnd(p)
+		line := s.src[p:lineEnd]
+		trimmed := strings.TrimSpace(line)
+		if defineRegex.MatchString(stripComment(trimmed)) {
+			depth++
+		} else if endefRegex.MatchString(trimmed) {
+			if depth == 0 {
+				start := p + strings.Index(line, "endef")
+				children = append(children, s.node(KeywordNode, start, start+len("endef")))
+				end, next = lineEnd, lineNext
+				break
+			}
+			depth--
+		}
+		children = append(children, s.node(TextNode, p, lineEnd))
+		// An unterminated define runs to the end of the file
+		end, next, p = lineEnd, lineNext, lineNext
+	}
+
+	node := s.node(DefineNode, pos, end)
+	node.Children = children
+	return node, end, next
+}
+
+// node creates a node covering src[start:end]
+func (s *syntaxScanner) node(kind NodeKind, start, end int) *Node {
+	return &Node{
+		Kind:  kind,
+		Range: Range{Start: s.position(start), End: s.position(end)},
+		Text:  s.src[start:end],
+	}
+}
+
+// add appends a token at offsets a and b of the statement at pos
+func (s *syntaxScanner) add(parent *Node, kind NodeKind, pos, a, b int) {
+	parent.Children = append(parent.Children, s.node(kind, pos+a, pos+b))
+}
+
+// addComment appends the trailing comment starting at offset comment, if any
+func (s *syntaxScanner) addComment(parent *Node, pos int, text string, comment int) {
+	if comment < 0 {
+		return
+	}
+	if _, b := trimSpan(text, comment, len(text)); b > comment {
+		s.add(parent, CommentNode, pos, comment, b)
+	}
+}
+
+// position converts a byte offset to a position
+func (s *syntaxScanner) position(offset int) Position {
+	line := sort.Search(len(s.lineStarts), func(i int) bool { return s.lineStarts[i] > offset })
+	return Position{Offset: offset, Line: line, Column: offset - s.lineStarts[line-1] + 1}
+}
+
+// lineEnd returns the end of the physical line at pos, without its line
+// terminator, and the start of the next line
+func (s *syntaxScanner) lineEnd(pos int) (int, int) {
+	nl := strings.IndexByte(s.src[pos:], '\n')
+	if nl < 0 {
+		return len(s.src), len(s.src)
+	}
+	end := pos + nl
+	if end > pos && s.src[end-1] == '\r' {
+		return end - 1, end + 1
+	}
+	return end, end + 1
+}
+
+// logicalEnd is like lineEnd but follows backslash-newline continuations
+func (s *syntaxScanner) logicalEnd(pos int) (int, int) {
+	for {
+		end, next := s.lineEnd(pos)
+		if next == end || next == len(s.src) || !continued(s.src[pos:end]) {
+			return end, next
+		}
+		pos = next
+	}
+}
+
+// logicalOffset returns the source offset of byte i of the logical line
+// starting at line, where each continuation is joined in place of its
+// line terminator
+func (s *syntaxScanner) logicalOffset(line, i int) int {
+	pos := s.lineStarts[line-1]
+	for {
+		end, next := s.lineEnd(pos)
+		if i < end-pos || next == end || next == len(s.src) || !continued(s.src[pos:end]) {
+			return pos + min(i, end-pos)
+		}
+		i -= end - pos
+		pos = next
+	}
+}
+
+// cook returns src[start:end] with continuations and carriage returns
+// replaced by blanks of the same length
+func (s *syntaxScanner) cook(start, end int) string {
+	text := s.src[start:end]
+	if !strings.ContainsAny(text, "\r\n") {
+		return text
+	}
+	b := []byte(text)
+	for i, c := range b {
+		switch c {
+		case '\n':
+			b[i] = ' '
+			j := i - 1
+			if j >= 0 && b[j] == '\r' {
+				j--
+			}
+			if j >= 0 && b[j] == '\\' {
+				b[j] = ' '
+			}
+		case '\r':
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// continued reports whether a line ends with an unescaped backslash
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// commentIndex returns the index of the first unescaped '#' in text at or
+// after from, or -1
+func commentIndex(text string, from int) int {
+	for i := from; i < len(text); i++ {
+		if text[i] == '#' && (i == 0 || text[i-1] != '\\') {
+			return i
+		}
+	}
+	return -1
+}
+
+// fields returns the offsets of the blank-separated words of text[from:to].
+// Blanks inside variable references don't split words.
+func fields(text string, from, to int) [][2]int {
+	var spans [][2]int
+	start, depth := -1, 0
+	for i := from; i < to; i++ {
+		c := text[i]
+		if depth == 0 && (c == ' ' || c == '\t') {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		switch {
+		case c == '$' && i+1 < to && (text[i+1] == '(' || text[i+1] == '{'):
+			depth++
+			i++
+		case depth > 0 && (c == '(' || c == '{'):
+			depth++
+		case depth > 0 && (c == ')' || c == '}'):
+			depth--
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, to})
+	}
+	return spans
+}
+
+// trimSpan narrows text[a:b] to exclude leading and trailing blanks
+func trimSpan(text string, a, b int) (int, int) {
+	for a < b && (text[a] == ' ' || text[a] == '\t') {
+		a++
+	}
+	for b > a && (text[b-1] == ' ' || text[b-1] == '\t') {
+		b--
+	}
+	return a, b
+}
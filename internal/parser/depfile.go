@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// isDependencyFile reports whether an included file is a dependency file
+// generated by a compiler, e.g. with gcc -MMD -MP. Makefile fragments that
+// happen to be named *.d are read as Makefiles.
+func isDependencyFile(path string) bool {
+	if filepath.Ext(path) != ".d" {
+		return false
+	}
+	src, err := os.ReadFile(path)
+	return err == nil && isGeneratedDependencies(string(src))
+}
+
+// isGeneratedDependencies reports whether src only holds what compilers
+// write: "targets: prerequisites" lines with continuations, empty rules and
+// comments. Assignments, directives, recipes and variable references are
+// never generated.
+func isGeneratedDependencies(src string) bool {
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+		if strings.HasPrefix(line, "\t") && strings.TrimSpace(line) != "" {
+			return false
+		}
+		for strings.HasSuffix(line, "\\") && !strings.HasSuffix(line, "\\\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSuffix(lines[i], "\r")
+		}
+		if c := commentIndex(line, 0); c >= 0 {
+			line = line[:c]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.ContainsAny(line, "=;") || strings.Contains(strings.ReplaceAll(line, "$$", ""), "$") {
+			return false
+		}
+		words := dependencyWords(line)
+		if len(words) < 2 || words[0] == ":" || !slices.Contains(words, ":") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDependencyFile reads a compiler-generated dependency file such as
+//
+//	main.o: main.c util.h my\ config.h \
+//	 gen/version.h
+//	util.h:
+//
+// Spaces and '#' in file names are escaped with a backslash and '$' is
+// doubled. Its rules are merged into the targets like any other rule,
+// marked as generated; the empty rules -MP adds for headers keep make from
+// failing when a header is removed.
+func (p *Parser) parseDependencyFile(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p.sources[path] = newSyntaxScanner(src)
+	p.makefile.Files = append(p.makefile.Files, path)
+
+	lines := strings.Split(string(src), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimSuffix(lines[i], "\r")
+		for strings.HasSuffix(line, "\\") && !strings.HasSuffix(line, "\\\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSuffix(lines[i], "\r")
+		}
+		words := dependencyWords(line)
+		colon := -1
+		for j, word := range words {
+			if word == ":" {
+				colon = j
+				break
+			}
+		}
+		if colon < 0 {
+			continue
+		}
+		for _, name := range words[:colon] {
+			p.addGeneratedRule(name, words[colon+1:], path, lineNumber)
+		}
+	}
+	return nil
+}
+
+// dependencyWords splits a line of a dependency file into unescaped file
+// names, with the rule's colon as a word of its own. Comments are dropped.
+func dependencyWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && (line[i+1] == ' ' || line[i+1] == '#' || line[i+1] == '\\'):
+			i++
+			word.WriteByte(line[i])
+		case c == '$' && i+1 < len(line) && line[i+1] == '$':
+			i++
+			word.WriteByte('$')
+		case c == '#':
+			flush()
+			return words
+		case c == ' ' || c == '\t':
+			flush()
+		case c == ':' && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t'):
+			// A colon inside a name, as in C:\include, is not the separator
+			flush()
+			words = append(words, ":")
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return words
+}
+
+// addGeneratedRule merges a rule read from a dependency file into target
+func (p *Parser) addGeneratedRule(name string, deps []string, file string, lineNumber int) {
+	entry := &Rule{
+		Dependencies: deps,
+		OrderOnly:    []string{},
+		Commands:     []string{},
+		File:         file,
+		LineNumber:   lineNumber,
+		Generated:    true,
+	}
+	if existing, ok := p.makefile.Targets[name]; ok {
+		existing.Rules = append(existing.Rules, entry)
+		existing.mergeRules()
+		return
+	}
+	p.makefile.Targets[name] = &Target{
+		Name:         name,
+		Dependencies: append([]string{}, deps...),
+		OrderOnly:    []string{},
+		Commands:     []string{},
+		IsPhony:      p.phony[name],
+		File:         file,
+		LineNumber:   lineNumber,
+		Rules:        []*Rule{entry},
+	}
+}
+
+// GeneratedDependencies returns the prerequisites of a target that only
+// dependency files list, such as the headers an object file includes
+func (t *Target) GeneratedDependencies() []string {
+	generated := []string{}
+	for _, dep := range t.Dependencies {
+		listed := false
+		for _, rule := range t.Rules {
+			if !rule.Generated && slices.Contains(rule.Dependencies, dep) {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			generated = append(generated, dep)
+		}
+	}
+	return generated
+}
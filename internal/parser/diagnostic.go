@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity ranks a diagnostic
+type Severity int
+
+const (
+	SeverityError   Severity = iota // make would stop reading the Makefile
+	SeverityWarning                 // make would print a warning and continue
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+// Diagnostic is a problem found while reading a Makefile. The parser
+// recovers from every problem it reports, so one bad line doesn't hide
+// the rest of the Makefile.
+type Diagnostic struct {
+	Severity Severity
+	Code     string // Stable identifier of the problem, e.g. "missing-separator"
+	File     string
+	Range    Range
+	Message  string
+}
+
+// String formats the diagnostic the way make prints it,
+// e.g. "Makefile:12: warning: overriding recipe for target 'build'"
+func (d *Diagnostic) String() string {
+	if d.Severity == SeverityWarning {
+		return fmt.Sprintf("%s:%d: warning: %s", d.File, d.Range.Start.Line, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: *** %s", d.File, d.Range.Start.Line, d.Message)
+}
+
+// report records a diagnostic on the Makefile
+func (p *Parser) report(severity Severity, code, file string, rng Range, format string, args ...interface{}) {
+	p.makefile.Diagnostics = append(p.makefile.Diagnostics, &Diagnostic{
+		Severity: severity,
+		Code:     code,
+		File:     file,
+		Range:    rng,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// lineRange returns the range of a whole physical line of file, without
+// its line terminator
+func (p *Parser) lineRange(file string, line int) Range {
+	s, ok := p.sources[file]
+	if !ok || line < 1 || line > len(s.lineStarts) {
+		pos := Position{Line: line, Column: 1}
+		return Range{Start: pos, End: pos}
+	}
+	start := s.lineStarts[line-1]
+	end, _ := s.lineEnd(start)
+	return Range{Start: s.position(start), End: s.position(end)}
+}
+
+// sourceRange returns the range of bytes a to b of the logical line that
+// starts at line in file, with continuation lines joined as parse joins them
+func (p *Parser) sourceRange(file string, line, a, b int) Range {
+	s, ok := p.sources[file]
+	if !ok || line < 1 || line > len(s.lineStarts) {
+		return Range{
+			Start: Position{Line: line, Column: a + 1},
+			End:   Position{Line: line, Column: b + 1},
+		}
+	}
+	return Range{
+		Start: s.position(s.logicalOffset(line, a)),
+		End:   s.position(s.logicalOffset(line, b)),
+	}
+}
+
+// SourceText returns the statement read from file at line as written, such
+// as a rule with its recipe or a define block
+func (p *Parser) SourceText(file string, line int) (string, bool) {
+	s, ok := p.sources[file]
+	if !ok {
+		return "", false
+	}
+	return ParseSyntax([]byte(s.src)).Statement(line)
+}
+
+// unterminatedReference returns the index of the first '$(' or '${' in
+// text that is never closed, or -1
+func unterminatedReference(text string) int {
+	for i := 0; i+1 < len(text); i++ {
+		if text[i] != '$' {
+			continue
+		}
+		switch text[i+1] {
+		case '$':
+			i++
+		case '(', '{':
+			end := matchingParen(text, i+1)
+			if end < 0 {
+				return i
+			}
+			// References nested inside are checked with the outer one
+			i = end
+		}
+	}
+	return -1
+}
+
+// checkReferences reports the first variable reference in text, the
+// logical line starting at line, that is never closed
+func (p *Parser) checkReferences(text string, line int) {
+	if i := unterminatedReference(text); i >= 0 {
+		p.report(SeverityError, "unterminated-reference", p.file, p.sourceRange(p.file, line, i, len(strings.TrimRight(text, " \t"))), "unterminated variable reference")
+	}
+}
+
+// checkSeparator reports a line that is neither a rule, an assignment nor
+// a directive but expands to text, with make's hint for recipe lines
+// indented with spaces
+func (p *Parser) checkSeparator(raw, expanded string, line int, inRule bool) {
+	if strings.TrimSpace(expanded) == "" {
+		return
+	}
+	// Without shell access the output of $(shell ...) is unknown
+	if !p.allowShell && (strings.Contains(expanded, "$(shell ") || strings.Contains(expanded, "${shell ")) {
+		return
+	}
+
+	indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+	rng := p.sourceRange(p.file, line, indent, len(strings.TrimRight(raw, " \t")))
+	spaces := len(raw) - len(strings.TrimLeft(raw, " "))
+	switch {
+	case strings.HasPrefix(raw, "\t"):
+		p.report(SeverityError, "recipe-before-target", p.file, rng, "recipe commences before first target")
+	case inRule && spaces > 0:
+		p.report(SeverityError, "missing-separator", p.file, rng, "missing separator (did you mean TAB instead of %d spaces?)", spaces)
+	default:
+		p.report(SeverityError, "missing-separator", p.file, rng, "missing separator")
+	}
+}
@@ -0,0 +1,283 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandContext carries the state of one expansion
+type expandContext struct {
+	visited       map[string]bool   // Recursive variables being expanded
+	locals        map[string]string // foreach/let variables and call arguments
+	keepUndefined bool              // Keep undefined references verbatim
+	errors        []string          // Messages from $(error ...) and invalid calls
+	callDepth     int               // Nesting depth of $(call ...)
+	target        string            // Target whose recipe is being expanded, if any
+}
+
+func newExpandContext(keepUndefined bool) *expandContext {
+	return &expandContext{
+		visited:       make(map[string]bool),
+		locals:        make(map[string]string),
+		keepUndefined: keepUndefined,
+	}
+}
+
+// SetAllowShell controls whether $(shell ...) and != assignments run
+// commands. It is off by default, leaving such references unexpanded.
+func (p *Parser) SetAllowShell(allow bool) {
+	p.allowShell = allow
+}
+
+// ExpandVariable expands a variable with all its references resolved
+func (p *Parser) ExpandVariable(name string) (string, error) {
+	return p.ExpandTargetVariable(name, "")
+}
+
+// ExpandTargetVariable expands a variable as make would inside the recipe
+// of target, taking target- and pattern-specific assignments into account.
+// An empty target expands the variable globally.
+func (p *Parser) ExpandTargetVariable(name, target string) (string, error) {
+	ctx := newExpandContext(true)
+	ctx.target = target
+	value, ok := p.lookupVariable(name, ctx)
+	if len(ctx.errors) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(ctx.errors, "; "))
+	}
+	if !ok {
+		return "", fmt.Errorf("variable not found: %s", name)
+	}
+	return value, nil
+}
+
+// expandText expands text while reading the Makefile, where undefined
+// variables expand to the empty string as they do in make
+func (p *Parser) expandText(text string) string {
+	return p.expand(text, newExpandContext(false))
+}
+
+// expand expands all variable references and function calls in text
+func (p *Parser) expand(text string, ctx *expandContext) string {
+	if !strings.Contains(text, "$") {
+		return text
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' || i+1 == len(text) {
+			b.WriteByte(text[i])
+			continue
+		}
+
+		switch next := text[i+1]; next {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '(', '{':
+			end := matchingParen(text, i+1)
+			if end < 0 {
+				ctx.errors = append(ctx.errors, "unterminated variable reference")
+				b.WriteString(text[i:])
+				return b.String()
+			}
+			b.WriteString(p.expandReference(text[i:end+1], text[i+2:end], next, ctx))
+			i = end
+		default:
+			// $X refers to the single-character variable X
+			b.WriteString(p.expandName(string(next), text[i:i+2], ctx))
+			i++
+		}
+	}
+	return b.String()
+}
+
+// expandReference expands the contents of $(...) or ${...}, which is
+// either a function call or a (possibly computed) variable name
+func (p *Parser) expandReference(ref, inner string, open byte, ctx *expandContext) string {
+	if name, args, ok := splitFunctionCall(inner); ok {
+		if fn, ok := functions[name]; ok {
+			return p.callFunction(name, fn, ref, args, open, ctx)
+		}
+	}
+	// $(VAR:a=b) and $(VAR:%.c=%.o) are substitution references
+	if name, subst, ok := splitUnquoted(inner, ':'); ok {
+		if from, to, ok := splitUnquoted(subst, '='); ok {
+			value, defined := p.lookupVariable(p.expand(name, ctx), ctx)
+			if !defined && ctx.keepUndefined {
+				return ref
+			}
+			from, to = p.expand(from, ctx), p.expand(to, ctx)
+			if !strings.Contains(from, "%") {
+				from, to = "%"+from, "%"+to
+			}
+			return patsubst(from, to, strings.Fields(value))
+		}
+	}
+	return p.expandName(p.expand(inner, ctx), ref, ctx)
+}
+
+// expandName expands a reference to the named variable, keeping ref
+// verbatim for undefined variables when the context asks for it
+func (p *Parser) expandName(name, ref string, ctx *expandContext) string {
+	value, ok := p.lookupVariable(name, ctx)
+	if !ok && ctx.keepUndefined {
+		return ref
+	}
+	return value
+}
+
+// lookupVariable returns the expanded value of a variable, looking at
+// foreach/call locals first, then target-specific assignments, then
+// Makefile variables, then the environment
+func (p *Parser) lookupVariable(name string, ctx *expandContext) (string, bool) {
+	if value, ok := ctx.locals[name]; ok {
+		return value, true
+	}
+	if ctx.target != "" {
+		scoped := []*Variable{}
+		for _, v := range p.TargetSpecificVariables(ctx.target) {
+			if v.Name == name {
+				scoped = append(scoped, v)
+			}
+		}
+		if len(scoped) > 0 {
+			return p.lookupScopedVariable(name, scoped, ctx)
+		}
+	}
+	return p.lookupGlobalVariable(name, ctx)
+}
+
+// lookupGlobalVariable returns the expanded value of a Makefile or
+// environment variable
+func (p *Parser) lookupGlobalVariable(name string, ctx *expandContext) (string, bool) {
+	variable, ok := p.makefile.Variables[name]
+	if !ok {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		return p.defaultVariable(name)
+	}
+
+	// Private global variables are not visible in any recipe
+	if variable.IsPrivate && ctx.target != "" {
+		return "", false
+	}
+
+	// Simple variables were expanded when they were defined
+	if variable.Flavor == SimpleFlavor {
+		return variable.Value, true
+	}
+
+	if ctx.visited[name] {
+		ctx.errors = append(ctx.errors, fmt.Sprintf("circular reference detected for variable: %s", name))
+		return "", false
+	}
+	ctx.visited[name] = true
+	defer delete(ctx.visited, name)
+
+	return p.expand(variable.Value, ctx), true
+}
+
+// defaultVariable returns the value make gives a variable the Makefile
+// and the environment don't set: MAKE runs make itself and CURDIR is the
+// directory make runs in
+func (p *Parser) defaultVariable(name string) (string, bool) {
+	switch name {
+	case "MAKE":
+		return "make", true
+	case "CURDIR":
+		dir, err := filepath.Abs(filepath.Dir(p.makefile.Path))
+		return dir, err == nil
+	}
+	return "", false
+}
+
+// lookupScopedVariable applies target-specific assignments on top of the
+// global value of a variable
+func (p *Parser) lookupScopedVariable(name string, scoped []*Variable, ctx *expandContext) (string, bool) {
+	value, defined := p.lookupGlobalVariable(name, ctx)
+
+	if ctx.visited[name] {
+		ctx.errors = append(ctx.errors, fmt.Sprintf("circular reference detected for variable: %s", name))
+		return "", false
+	}
+	ctx.visited[name] = true
+	defer delete(ctx.visited, name)
+
+	for _, v := range scoped {
+		if v.Type == ConditionalAssignment && defined {
+			continue
+		}
+		text := v.Value
+		if v.Flavor == RecursiveFlavor {
+			text = p.expand(v.Value, ctx)
+		}
+		if v.Type == AppendAssignment && value != "" {
+			text = value + " " + text
+		}
+		value, defined = text, true
+	}
+	return value, true
+}
+
+// matchingParen returns the index of the parenthesis closing the one at
+// open, counting nested parentheses of the same kind as make does
+func matchingParen(text string, open int) int {
+	openChar := text[open]
+	closeChar := byte(')')
+	if openChar == '{' {
+		closeChar = '}'
+	}
+
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case openChar:
+			depth++
+		case closeChar:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitFunctionCall splits "name args" into the function name and the
+// unsplit argument text. The name must be followed by a blank.
+func splitFunctionCall(inner string) (string, string, bool) {
+	idx := strings.IndexAny(inner, " \t")
+	if idx <= 0 {
+		return "", "", false
+	}
+	return inner[:idx], strings.TrimLeft(inner[idx:], " \t"), true
+}
+
+// splitArgs splits function arguments at top-level commas. Once max
+// arguments are found the remaining text, commas included, is the last one.
+func splitArgs(args string, open byte, max int) []string {
+	closeChar := byte(')')
+	if open == '{' {
+		closeChar = '}'
+	}
+
+	var result []string
+	depth, start := 0, 0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case open:
+			depth++
+		case closeChar:
+			depth--
+		case ',':
+			if depth == 0 && (max <= 0 || len(result) < max-1) {
+				result = append(result, args[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, args[start:])
+}
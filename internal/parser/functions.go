@@ -0,0 +1,647 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shellTimeout bounds commands run by $(shell ...) and != assignments
+const shellTimeout = 10 * time.Second
+
+// maxCallDepth limits recursion through $(call ...)
+const maxCallDepth = 1000
+
+// makeFunction describes a GNU make built-in function
+type makeFunction struct {
+	minArgs int
+	maxArgs int  // 0 means no limit
+	lazy    bool // Arguments are passed unexpanded, the function expands them
+	call    func(p *Parser, args []string, ctx *expandContext) string
+}
+
+// functions is the table of built-in functions. It is filled in init
+// because the functions themselves expand text.
+var functions map[string]makeFunction
+
+func init() {
+	functions = map[string]makeFunction{
+		// Text functions
+		"subst":      {3, 3, false, fnSubst},
+		"patsubst":   {3, 3, false, fnPatsubst},
+		"strip":      {1, 1, false, fnStrip},
+		"findstring": {2, 2, false, fnFindstring},
+		"filter":     {2, 2, false, fnFilter},
+		"filter-out": {2, 2, false, fnFilterOut},
+		"sort":       {1, 1, false, fnSort},
+		"word":       {2, 2, false, fnWord},
+		"wordlist":   {3, 3, false, fnWordlist},
+		"words":      {1, 1, false, fnWords},
+		"firstword":  {1, 1, false, fnFirstword},
+		"lastword":   {1, 1, false, fnLastword},
+		"intcmp":     {2, 5, false, fnIntcmp},
+
+		// File name functions
+		"dir":       {1, 1, false, fnDir},
+		"notdir":    {1, 1, false, fnNotdir},
+		"suffix":    {1, 1, false, fnSuffix},
+		"basename":  {1, 1, false, fnBasename},
+		"addsuffix": {2, 2, false, fnAddsuffix},
+		"addprefix": {2, 2, false, fnAddprefix},
+		"join":      {2, 2, false, fnJoin},
+		"wildcard":  {1, 1, false, fnWildcard},
+		"realpath":  {1, 1, false, fnRealpath},
+		"abspath":   {1, 1, false, fnAbspath},
+
+		// Conditional functions expand only the arguments they need
+		"if":  {2, 3, true, fnIf},
+		"or":  {1, 0, true, fnOr},
+		"and": {1, 0, true, fnAnd},
+
+		// Variable and control functions
+		"foreach": {3, 3, true, fnForeach},
+		"let":     {3, 3, true, fnLet},
+		"call":    {1, 0, false, fnCall},
+		"value":   {1, 1, false, fnValue},
+		"origin":  {1, 1, false, fnOrigin},
+		"flavor":  {1, 1, false, fnFlavor},
+		"eval":    {1, 1, false, fnEval},
+		"file":    {1, 2, false, fnFile},
+		"shell":   {1, 1, false, fnShell},
+		"error":   {0, 1, false, fnError},
+		"warning": {0, 1, false, fnMessage},
+		"info":    {0, 1, false, fnMessage},
+	}
+}
+
+// IsFunction reports whether name is a GNU make built-in function
+func IsFunction(name string) bool {
+	_, ok := functions[name]
+	return ok
+}
+
+// callFunction splits and expands the arguments of a function call and
+// evaluates it. ref is the whole reference, kept when shell is disabled.
+func (p *Parser) callFunction(name string, fn makeFunction, ref, args string, open byte, ctx *expandContext) string {
+	if name == "shell" && !p.allowShell {
+		return ref
+	}
+
+	argv := splitArgs(args, open, fn.maxArgs)
+	if len(argv) < fn.minArgs {
+		ctx.errors = append(ctx.errors, fmt.Sprintf("insufficient number of arguments (%d) to function '%s'", len(argv), name))
+		return ""
+	}
+
+	// Functions see undefined variables as empty, whatever the caller asked for
+	keep := ctx.keepUndefined
+	ctx.keepUndefined = false
+	defer func() { ctx.keepUndefined = keep }()
+
+	if !fn.lazy {
+		for i, arg := range argv {
+			argv[i] = p.expand(arg, ctx)
+		}
+	}
+	return fn.call(p, argv, ctx)
+}
+
+func fnSubst(p *Parser, args []string, ctx *expandContext) string {
+	if args[0] == "" {
+		return args[2] + args[1]
+	}
+	return strings.ReplaceAll(args[2], args[0], args[1])
+}
+
+func fnPatsubst(p *Parser, args []string, ctx *expandContext) string {
+	return patsubst(args[0], args[1], strings.Fields(args[2]))
+}
+
+// patsubst replaces words matching pattern with replacement, where '%'
+// in the replacement stands for the stem matched by '%' in the pattern
+func patsubst(pattern, replacement string, words []string) string {
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		stem, ok := matchPattern(pattern, word)
+		switch {
+		case !ok:
+			result = append(result, word)
+		case strings.Contains(pattern, "%"):
+			result = append(result, strings.Replace(replacement, "%", stem, 1))
+		default:
+			result = append(result, replacement)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+func fnStrip(p *Parser, args []string, ctx *expandContext) string {
+	return strings.Join(strings.Fields(args[0]), " ")
+}
+
+func fnFindstring(p *Parser, args []string, ctx *expandContext) string {
+	if strings.Contains(args[1], args[0]) {
+		return args[0]
+	}
+	return ""
+}
+
+func fnFilter(p *Parser, args []string, ctx *expandContext) string {
+	return filterWords(strings.Fields(args[0]), strings.Fields(args[1]), true)
+}
+
+func fnFilterOut(p *Parser, args []string, ctx *expandContext) string {
+	return filterWords(strings.Fields(args[0]), strings.Fields(args[1]), false)
+}
+
+// filterWords keeps the words that match (or, with keep unset, don't
+// match) any of the patterns
+func filterWords(patterns, words []string, keep bool) string {
+	result := []string{}
+	for _, word := range words {
+		matched := false
+		for _, pattern := range patterns {
+			if _, ok := matchPattern(pattern, word); ok {
+				matched = true
+				break
+			}
+		}
+		if matched == keep {
+			result = append(result, word)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+func fnSort(p *Parser, args []string, ctx *expandContext) string {
+	words := strings.Fields(args[0])
+	sort.Strings(words)
+	result := []string{}
+	for i, word := range words {
+		if i == 0 || word != words[i-1] {
+			result = append(result, word)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+// wordIndex parses the numeric argument of word and wordlist
+func wordIndex(name, arg string, ctx *expandContext) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || n < 0 {
+		ctx.errors = append(ctx.errors, fmt.Sprintf("non-numeric first argument to '%s' function: '%s'", name, strings.TrimSpace(arg)))
+		return 0, false
+	}
+	return n, true
+}
+
+func fnWord(p *Parser, args []string, ctx *expandContext) string {
+	n, ok := wordIndex("word", args[0], ctx)
+	if !ok {
+		return ""
+	}
+	if n == 0 {
+		ctx.errors = append(ctx.errors, "first argument to 'word' function must be greater than 0")
+		return ""
+	}
+	words := strings.Fields(args[1])
+	if n > len(words) {
+		return ""
+	}
+	return words[n-1]
+}
+
+func fnWordlist(p *Parser, args []string, ctx *expandContext) string {
+	start, ok := wordIndex("wordlist", args[0], ctx)
+	if !ok {
+		return ""
+	}
+	end, ok := wordIndex("wordlist", args[1], ctx)
+	if !ok {
+		return ""
+	}
+	if start == 0 {
+		ctx.errors = append(ctx.errors, "invalid first argument to 'wordlist' function")
+		return ""
+	}
+	words := strings.Fields(args[2])
+	if end > len(words) {
+		end = len(words)
+	}
+	if start > end {
+		return ""
+	}
+	return strings.Join(words[start-1:end], " ")
+}
+
+func fnWords(p *Parser, args []string, ctx *expandContext) string {
+	return strconv.Itoa(len(strings.Fields(args[0])))
+}
+
+func fnFirstword(p *Parser, args []string, ctx *expandContext) string {
+	if words := strings.Fields(args[0]); len(words) > 0 {
+		return words[0]
+	}
+	return ""
+}
+
+func fnLastword(p *Parser, args []string, ctx *expandContext) string {
+	if words := strings.Fields(args[0]); len(words) > 0 {
+		return words[len(words)-1]
+	}
+	return ""
+}
+
+func fnIntcmp(p *Parser, args []string, ctx *expandContext) string {
+	lhs, err1 := strconv.Atoi(strings.TrimSpace(args[0]))
+	rhs, err2 := strconv.Atoi(strings.TrimSpace(args[1]))
+	if err1 != nil || err2 != nil {
+		ctx.errors = append(ctx.errors, "non-numeric argument to 'intcmp' function")
+		return ""
+	}
+	if len(args) == 2 {
+		if lhs == rhs {
+			return strconv.Itoa(lhs)
+		}
+		return ""
+	}
+
+	lt, eq, gt := args[2], "", ""
+	if len(args) > 3 {
+		eq, gt = args[3], args[3]
+	}
+	if len(args) > 4 {
+		gt = args[4]
+	}
+	switch {
+	case lhs < rhs:
+		return lt
+	case lhs == rhs:
+		return eq
+	default:
+		return gt
+	}
+}
+
+// mapWords applies fn to each word of text
+func mapWords(text string, fn func(string) string) string {
+	words := strings.Fields(text)
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		if mapped := fn(word); mapped != "" {
+			result = append(result, mapped)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+func fnDir(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[0], func(word string) string {
+		if idx := strings.LastIndexByte(word, '/'); idx >= 0 {
+			return word[:idx+1]
+		}
+		return "./"
+	})
+}
+
+func fnNotdir(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[0], func(word string) string {
+		return word[strings.LastIndexByte(word, '/')+1:]
+	})
+}
+
+// splitSuffix splits a word at the last '.' of its file name part
+func splitSuffix(word string) (string, string) {
+	idx := strings.LastIndexByte(word, '.')
+	if idx < 0 || strings.LastIndexByte(word, '/') > idx {
+		return word, ""
+	}
+	return word[:idx], word[idx:]
+}
+
+func fnSuffix(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[0], func(word string) string {
+		_, suffix := splitSuffix(word)
+		return suffix
+	})
+}
+
+func fnBasename(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[0], func(word string) string {
+		base, _ := splitSuffix(word)
+		return base
+	})
+}
+
+func fnAddsuffix(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[1], func(word string) string {
+		return word + args[0]
+	})
+}
+
+func fnAddprefix(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[1], func(word string) string {
+		return args[0] + word
+	})
+}
+
+func fnJoin(p *Parser, args []string, ctx *expandContext) string {
+	first, second := strings.Fields(args[0]), strings.Fields(args[1])
+	n := len(first)
+	if len(second) > n {
+		n = len(second)
+	}
+	result := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		word := ""
+		if i < len(first) {
+			word += first[i]
+		}
+		if i < len(second) {
+			word += second[i]
+		}
+		result = append(result, word)
+	}
+	return strings.Join(result, " ")
+}
+
+// baseDir is the directory make would run in, the one holding the Makefile
+func (p *Parser) baseDir() string {
+	return filepath.Dir(p.makefile.Path)
+}
+
+// resolvePath resolves a file name relative to the Makefile's directory
+func (p *Parser) resolvePath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(p.baseDir(), name)
+}
+
+func fnWildcard(p *Parser, args []string, ctx *expandContext) string {
+	result := []string{}
+	for _, pattern := range strings.Fields(args[0]) {
+		matches, _ := filepath.Glob(p.resolvePath(pattern))
+		sort.Strings(matches)
+		for _, match := range matches {
+			if !filepath.IsAbs(pattern) {
+				// Report names the way they were asked for, relative to the Makefile
+				if rel, err := filepath.Rel(p.baseDir(), match); err == nil {
+					match = rel
+				}
+			}
+			result = append(result, match)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+func fnRealpath(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[0], func(word string) string {
+		abs, err := filepath.Abs(p.resolvePath(word))
+		if err != nil {
+			return ""
+		}
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			return ""
+		}
+		return resolved
+	})
+}
+
+func fnAbspath(p *Parser, args []string, ctx *expandContext) string {
+	return mapWords(args[0], func(word string) string {
+		abs, err := filepath.Abs(p.resolvePath(word))
+		if err != nil {
+			return ""
+		}
+		return abs
+	})
+}
+
+func fnIf(p *Parser, args []string, ctx *expandContext) string {
+	if strings.TrimSpace(p.expand(args[0], ctx)) != "" {
+		return p.expand(args[1], ctx)
+	}
+	if len(args) > 2 {
+		return p.expand(args[2], ctx)
+	}
+	return ""
+}
+
+func fnOr(p *Parser, args []string, ctx *expandContext) string {
+	for _, arg := range args {
+		if value := p.expand(arg, ctx); strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func fnAnd(p *Parser, args []string, ctx *expandContext) string {
+	value := ""
+	for _, arg := range args {
+		if value = p.expand(arg, ctx); strings.TrimSpace(value) == "" {
+			return ""
+		}
+	}
+	return value
+}
+
+// withLocals runs fn with the given local variables in scope
+func withLocals(ctx *expandContext, locals map[string]string, fn func() string) string {
+	saved := ctx.locals
+	ctx.locals = make(map[string]string, len(saved)+len(locals))
+	for k, v := range saved {
+		ctx.locals[k] = v
+	}
+	for k, v := range locals {
+		ctx.locals[k] = v
+	}
+	defer func() { ctx.locals = saved }()
+	return fn()
+}
+
+func fnForeach(p *Parser, args []string, ctx *expandContext) string {
+	name := strings.TrimSpace(p.expand(args[0], ctx))
+	words := strings.Fields(p.expand(args[1], ctx))
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		value := withLocals(ctx, map[string]string{name: word}, func() string {
+			return p.expand(args[2], ctx)
+		})
+		result = append(result, value)
+	}
+	return strings.Join(result, " ")
+}
+
+func fnLet(p *Parser, args []string, ctx *expandContext) string {
+	names := strings.Fields(p.expand(args[0], ctx))
+	words := strings.Fields(p.expand(args[1], ctx))
+	locals := make(map[string]string, len(names))
+	for i, name := range names {
+		switch {
+		case i == len(names)-1 && i < len(words):
+			// The last variable takes all remaining words
+			locals[name] = strings.Join(words[i:], " ")
+		case i < len(words):
+			locals[name] = words[i]
+		default:
+			locals[name] = ""
+		}
+	}
+	return withLocals(ctx, locals, func() string {
+		return p.expand(args[2], ctx)
+	})
+}
+
+func fnCall(p *Parser, args []string, ctx *expandContext) string {
+	name := strings.TrimSpace(args[0])
+	locals := map[string]string{"0": name}
+	for i, arg := range args[1:] {
+		locals[strconv.Itoa(i+1)] = arg
+	}
+
+	// Arguments of an enclosing call must not leak into this one
+	saved := ctx.locals
+	ctx.locals = make(map[string]string, len(saved))
+	for k, v := range saved {
+		if _, err := strconv.Atoi(k); err != nil {
+			ctx.locals[k] = v
+		}
+	}
+	defer func() { ctx.locals = saved }()
+
+	// $(call) on a built-in function calls the function directly
+	if fn, ok := functions[name]; ok && len(args)-1 >= fn.minArgs && !fn.lazy {
+		return fn.call(p, args[1:], ctx)
+	}
+
+	// Variables may call themselves recursively through call, up to a limit
+	if ctx.callDepth >= maxCallDepth {
+		ctx.errors = append(ctx.errors, fmt.Sprintf("recursion too deep in call to '%s'", name))
+		return ""
+	}
+	ctx.callDepth++
+	expanding := ctx.visited[name]
+	delete(ctx.visited, name)
+	defer func() {
+		ctx.callDepth--
+		if expanding {
+			ctx.visited[name] = true
+		}
+	}()
+
+	return withLocals(ctx, locals, func() string {
+		value, _ := p.lookupVariable(name, ctx)
+		return value
+	})
+}
+
+func fnValue(p *Parser, args []string, ctx *expandContext) string {
+	name := strings.TrimSpace(args[0])
+	if variable, ok := p.makefile.Variables[name]; ok {
+		return variable.Value
+	}
+	return os.Getenv(name)
+}
+
+func fnOrigin(p *Parser, args []string, ctx *expandContext) string {
+	name := strings.TrimSpace(args[0])
+	if _, ok := ctx.locals[name]; ok {
+		return "automatic"
+	}
+	if variable, ok := p.makefile.Variables[name]; ok {
+		if variable.IsOverride {
+			return "override"
+		}
+		return "file"
+	}
+	if _, ok := os.LookupEnv(name); ok {
+		return "environment"
+	}
+	return "undefined"
+}
+
+func fnFlavor(p *Parser, args []string, ctx *expandContext) string {
+	name := strings.TrimSpace(args[0])
+	if variable, ok := p.makefile.Variables[name]; ok {
+		return variable.Flavor.String()
+	}
+	if _, ok := os.LookupEnv(name); ok {
+		return RecursiveFlavor.String()
+	}
+	return "undefined"
+}
+
+func fnEval(p *Parser, args []string, ctx *expandContext) string {
+	// eval only has an effect while the Makefile is being read
+	if p.reading == 0 {
+		return ""
+	}
+	if err := p.eval(args[0]); err != nil {
+		ctx.errors = append(ctx.errors, err.Error())
+	}
+	return ""
+}
+
+func fnFile(p *Parser, args []string, ctx *expandContext) string {
+	op := strings.TrimSpace(args[0])
+	// Writing files is a side effect that analysis must not have
+	if !strings.HasPrefix(op, "<") {
+		return ""
+	}
+	data, err := os.ReadFile(p.resolvePath(strings.TrimSpace(op[1:])))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+func fnShell(p *Parser, args []string, ctx *expandContext) string {
+	output, err := p.runShell(args[0])
+	if err != nil {
+		ctx.errors = append(ctx.errors, err.Error())
+	}
+	return output
+}
+
+// runShell runs a command the way $(shell ...) does: in the Makefile's
+// directory, with trailing newlines removed and other newlines as spaces
+func (p *Parser) runShell(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shellTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Dir = p.baseDir()
+	output, err := cmd.Output()
+	result := strings.ReplaceAll(strings.TrimRight(string(output), "\n"), "\n", " ")
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("shell command timed out: %s", command)
+	}
+	// make ignores the exit status of $(shell ...) commands
+	if _, ok := err.(*exec.ExitError); ok {
+		err = nil
+	}
+	return result, err
+}
+
+func fnError(p *Parser, args []string, ctx *expandContext) string {
+	message := ""
+	if len(args) > 0 {
+		message = args[0]
+	}
+	ctx.errors = append(ctx.errors, message)
+	return ""
+}
+
+func fnMessage(p *Parser, args []string, ctx *expandContext) string {
+	return ""
+}
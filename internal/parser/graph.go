@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// specialTargets are the targets make gives a special meaning
+var specialTargets = map[string]bool{
+	".PHONY": true, ".SUFFIXES": true, ".DEFAULT": true, ".PRECIOUS": true,
+	".INTERMEDIATE": true, ".NOTINTERMEDIATE": true, ".SECONDARY": true,
+	".SECONDEXPANSION": true, ".DELETE_ON_ERROR": true, ".IGNORE": true,
+	".LOW_RESOLUTION_TIME": true, ".SILENT": true, ".EXPORT_ALL_VARIABLES": true,
+	".NOTPARALLEL": true, ".ONESHELL": true, ".POSIX": true, ".WAIT": true,
+}
+
+// defaultSuffixes are make's default .SUFFIXES, which old-fashioned suffix
+// rules such as ".c.o" are named after
+var defaultSuffixes = []string{
+	".out", ".a", ".ln", ".o", ".c", ".cc", ".C", ".cpp", ".p", ".f", ".F",
+	".m", ".r", ".y", ".l", ".ym", ".yl", ".s", ".S", ".mod", ".sym", ".def",
+	".h", ".info", ".dvi", ".tex", ".texinfo", ".texi", ".txinfo", ".w",
+	".ch", ".web", ".sh", ".elc", ".el",
+}
+
+// IsSpecialTarget reports whether name is a special target such as
+// .SUFFIXES, whose prerequisites are not dependencies, or a suffix rule
+// such as .c.o, which defines an implicit rule rather than a target
+func IsSpecialTarget(name string) bool {
+	return specialTargets[name] || isSuffixRule(name)
+}
+
+// isSuffixRule reports whether name is a single-suffix rule such as ".c"
+// or a double-suffix rule such as ".c.o"
+func isSuffixRule(name string) bool {
+	for _, source := range defaultSuffixes {
+		rest, ok := strings.CutPrefix(name, source)
+		if ok && (rest == "" || slices.Contains(defaultSuffixes, rest)) {
+			return true
+		}
+	}
+	return false
+}
+
+// DependencyEdge is a prerequisite relation between two targets, with the
+// rule that declared it
+type DependencyEdge struct {
+	From       string // Target
+	To         string // Prerequisite
+	OrderOnly  bool
+	Wait       bool // A .WAIT precedes the prerequisite
+	Generated  bool // Only listed in dependency files
+	File       string
+	LineNumber int
+}
+
+// DroppedMessage returns the message make prints when it drops the edge
+// to break a cycle
+func (e *DependencyEdge) DroppedMessage() string {
+	return fmt.Sprintf("Circular %s <- %s dependency dropped.", e.From, e.To)
+}
+
+// Cycle is a strongly connected component of the dependency graph: a set
+// of targets that all depend on each other, directly or indirectly
+type Cycle struct {
+	Targets []string          // Targets of the component, in definition order
+	Edges   []*DependencyEdge // Edges between targets of the component
+	Dropped []*DependencyEdge // Edges make drops when it meets the cycle
+}
+
+// Messages returns the messages make prints for the dropped edges,
+// e.g. "Circular a <- b dependency dropped."
+func (c *Cycle) Messages() []string {
+	messages := []string{}
+	for _, e := range c.Dropped {
+		messages = append(messages, e.DroppedMessage())
+	}
+	return messages
+}
+
+// Edges returns the prerequisite edges of a target in the order make
+// considers them: normal prerequisites first, then order-only ones. Each
+// edge records the first rule that lists the prerequisite. .WAIT is not a
+// prerequisite; it marks the edge that follows it.
+func (p *Parser) Edges(name string) []*DependencyEdge {
+	target, ok := p.makefile.Targets[name]
+	if !ok {
+		return nil
+	}
+	edges := []*DependencyEdge{}
+	generated := target.GeneratedDependencies()
+	wait := false
+	add := func(dep string, orderOnly bool) {
+		if dep == ".WAIT" {
+			wait = true
+			return
+		}
+		edge := &DependencyEdge{From: name, To: dep, OrderOnly: orderOnly, Wait: wait, File: target.File, LineNumber: target.LineNumber}
+		edge.Generated = !orderOnly && slices.Contains(generated, dep)
+		wait = false
+		for _, rule := range target.Rules {
+			list := rule.Dependencies
+			if orderOnly {
+				list = rule.OrderOnly
+			}
+			if slices.Contains(list, dep) {
+				edge.File, edge.LineNumber = rule.File, rule.LineNumber
+				break
+			}
+		}
+		edges = append(edges, edge)
+	}
+	for _, dep := range target.Dependencies {
+		add(dep, false)
+	}
+	for _, dep := range target.OrderOnly {
+		// A prerequisite that is also normal is not order-only
+		if dep == ".WAIT" || !slices.Contains(target.Dependencies, dep) {
+			add(dep, true)
+		}
+	}
+	return edges
+}
+
+// OrderedTargets returns the targets in the order they were defined,
+// following the order files were read
+func (p *Parser) OrderedTargets() []*Target {
+	fileOrder := make(map[string]int)
+	for i, f := range p.makefile.Files {
+		if _, ok := fileOrder[f]; !ok {
+			fileOrder[f] = i
+		}
+	}
+	targets := make([]*Target, 0, len(p.makefile.Targets))
+	for _, t := range p.makefile.Targets {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		if fileOrder[a.File] != fileOrder[b.File] {
+			return fileOrder[a.File] < fileOrder[b.File]
+		}
+		if a.LineNumber != b.LineNumber {
+			return a.LineNumber < b.LineNumber
+		}
+		return a.Name < b.Name
+	})
+	return targets
+}
+
+// FindCycles returns every cycle in the dependency graph, including
+// targets that depend on themselves. The edges make would drop are found
+// by walking the targets depth-first in definition order, as make walks
+// the prerequisites of its goals.
+func (p *Parser) FindCycles() []*Cycle {
+	targets := p.OrderedTargets()
+	edges := make(map[string][]*DependencyEdge)
+	for _, t := range targets {
+		if IsSpecialTarget(t.Name) {
+			continue
+		}
+		for _, e := range p.Edges(t.Name) {
+			if _, ok := p.makefile.Targets[e.To]; ok {
+				edges[t.Name] = append(edges[t.Name], e)
+			}
+		}
+	}
+
+	// Tarjan's algorithm for strongly connected components
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	component := make(map[string]int)
+	var stack []string
+	var components [][]string
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = len(index)
+		lowlink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, e := range edges[name] {
+			if _, seen := index[e.To]; !seen {
+				connect(e.To)
+				lowlink[name] = min(lowlink[name], lowlink[e.To])
+			} else if onStack[e.To] {
+				lowlink[name] = min(lowlink[name], index[e.To])
+			}
+		}
+		if lowlink[name] != index[name] {
+			return
+		}
+		var members []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component[top] = len(components)
+			members = append(members, top)
+			if top == name {
+				break
+			}
+		}
+		components = append(components, members)
+	}
+	for _, t := range targets {
+		if _, seen := index[t.Name]; !seen {
+			connect(t.Name)
+		}
+	}
+
+	cycles := make(map[int]*Cycle)
+	var result []*Cycle
+	for _, t := range targets {
+		id := component[t.Name]
+		cycle, ok := cycles[id]
+		if !ok {
+			cycle = &Cycle{Targets: []string{}, Edges: []*DependencyEdge{}, Dropped: []*DependencyEdge{}}
+			cycles[id] = cycle
+		}
+		cycle.Targets = append(cycle.Targets, t.Name)
+		for _, e := range edges[t.Name] {
+			if component[e.To] == id {
+				cycle.Edges = append(cycle.Edges, e)
+			}
+		}
+		// A single target is a cycle only if it depends on itself
+		if !ok && (len(components[id]) > 1 || len(cycle.Edges) > 0) {
+			result = append(result, cycle)
+		} else if !ok {
+			delete(cycles, id)
+		}
+	}
+
+	// make drops an edge when its prerequisite is still being updated
+	const (
+		unvisited = iota
+		updating
+		done
+	)
+	state := make(map[string]int)
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = updating
+		for _, e := range edges[name] {
+			switch state[e.To] {
+			case updating:
+				if cycle, ok := cycles[component[name]]; ok {
+					cycle.Dropped = append(cycle.Dropped, e)
+				}
+			case unvisited:
+				visit(e.To)
+			}
+		}
+		state[name] = done
+	}
+	for _, t := range targets {
+		if state[t.Name] == unvisited {
+			visit(t.Name)
+		}
+	}
+	return result
+}
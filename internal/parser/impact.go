@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"path/filepath"
+	"slices"
+)
+
+// Impact is a target make would rebuild because files it depends on changed
+type Impact struct {
+	Target  string
+	Phony   bool
+	Changed []string // Changed files the target depends on, directly or not
+}
+
+// ImpactReport describes what a set of changed files affects
+type ImpactReport struct {
+	Changed   []string  // Changed files, relative to the Makefile's directory
+	Targets   []*Impact // Affected targets in definition order, then in order of discovery
+	Unused    []string  // Changed files no target depends on
+	Makefiles []string  // Changed files that were read as part of the Makefile
+}
+
+// AffectedTargets returns every target that depends on one of the changed
+// files, following explicit prerequisites, pattern rules and the rules of
+// included files. Paths are relative to the Makefile's directory unless
+// absolute. Order-only prerequisites are not followed since a change to
+// them never makes a target out of date.
+func (p *Parser) AffectedTargets(changed []string) *ImpactReport {
+	dir := filepath.Dir(p.makefile.Path)
+	normalize := func(path string) string {
+		if filepath.IsAbs(path) {
+			if abs, err := filepath.Abs(dir); err == nil {
+				if rel, err := filepath.Rel(abs, path); err == nil {
+					path = rel
+				}
+			}
+		}
+		return filepath.Clean(path)
+	}
+
+	// Walk every target and prerequisite once to find their dependents
+	dependents := make(map[string][]string)
+	seen := make(map[string]bool)
+	var order []string
+	queue := []string{}
+	for _, t := range p.OrderedTargets() {
+		if !IsSpecialTarget(t.Name) {
+			queue = append(queue, t.Name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		step := p.planStep(name)
+		if step == nil {
+			continue
+		}
+		order = append(order, name)
+		for _, e := range step.edges {
+			if e.OrderOnly {
+				continue
+			}
+			key := filepath.Clean(e.To)
+			dependents[key] = appendUnique(dependents[key], name)
+			queue = append(queue, e.To)
+		}
+	}
+
+	report := &ImpactReport{Changed: []string{}, Targets: []*Impact{}, Unused: []string{}, Makefiles: []string{}}
+	impacts := make(map[string]*Impact)
+	for _, path := range changed {
+		path = normalize(path)
+		if slices.Contains(report.Changed, path) {
+			continue
+		}
+		report.Changed = append(report.Changed, path)
+
+		for _, file := range p.makefile.Files {
+			if rel, err := filepath.Rel(dir, file); err == nil && filepath.Clean(rel) == path {
+				report.Makefiles = appendUnique(report.Makefiles, path)
+			}
+		}
+
+		if len(dependents[path]) == 0 {
+			report.Unused = append(report.Unused, path)
+			continue
+		}
+		visited := make(map[string]bool)
+		queue := append([]string{}, dependents[path]...)
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+			impact, ok := impacts[name]
+			if !ok {
+				impact = &Impact{Target: name}
+				if t, ok := p.makefile.Targets[name]; ok {
+					impact.Phony = t.IsPhony
+				}
+				impacts[name] = impact
+			}
+			impact.Changed = appendUnique(impact.Changed, path)
+			queue = append(queue, dependents[filepath.Clean(name)]...)
+		}
+	}
+
+	for _, name := range order {
+		if impact, ok := impacts[name]; ok {
+			report.Targets = append(report.Targets, impact)
+		}
+	}
+	return report
+}
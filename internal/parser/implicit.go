@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FindImplicitRule searches the pattern rules for one that can build name,
+// as make does for targets without a recipe of their own. Among applicable
+// rules the one with the shortest stem wins, then the earliest defined.
+func (p *Parser) FindImplicitRule(name string) (*ImplicitMatch, bool) {
+	match := p.findImplicitRule(name, map[string]bool{})
+	return match, match != nil
+}
+
+func (p *Parser) findImplicitRule(name string, visited map[string]bool) *ImplicitMatch {
+	if visited[name] {
+		return nil
+	}
+	visited[name] = true
+	defer delete(visited, name)
+
+	var best *ImplicitMatch
+	for _, rule := range p.makefile.PatternRules {
+		// A pattern rule without a recipe cancels a rule, it can't build anything
+		if len(rule.Commands) == 0 {
+			continue
+		}
+		for _, pattern := range rule.Targets {
+			stem, dir, ok := matchTargetPattern(pattern, name)
+			if !ok || (best != nil && len(dir+stem) >= len(best.Stem)) {
+				continue
+			}
+
+			match := &ImplicitMatch{
+				Target:       name,
+				Rule:         rule,
+				Stem:         dir + stem,
+				Dependencies: []string{},
+				OrderOnly:    []string{},
+			}
+			for _, dep := range rule.OrderOnly {
+				dep = strings.Replace(dep, "%", stem, 1)
+				if dir != "" && !strings.Contains(dep, "/") {
+					dep = dir + dep
+				}
+				match.OrderOnly = append(match.OrderOnly, dep)
+			}
+			satisfied := true
+			for _, dep := range rule.Dependencies {
+				dep = strings.Replace(dep, "%", stem, 1)
+				if dir != "" && !strings.Contains(dep, "/") {
+					dep = dir + dep
+				}
+				match.Dependencies = append(match.Dependencies, dep)
+
+				if p.fileExists(dep) || p.mentioned(dep) {
+					continue
+				}
+				// The prerequisite may itself be made by a chain of implicit rules
+				if sub := p.findImplicitRule(dep, visited); sub != nil {
+					match.Chain = append(match.Chain, sub)
+					continue
+				}
+				satisfied = false
+				break
+			}
+			if satisfied {
+				best = match
+			}
+		}
+	}
+	return best
+}
+
+// matchTargetPattern matches name against a target pattern. Patterns
+// without a slash match the file name only; the directory is returned
+// separately so it can be prepended to the stem and prerequisites.
+func matchTargetPattern(pattern, name string) (stem, dir string, ok bool) {
+	if !strings.Contains(pattern, "/") {
+		if idx := strings.LastIndexByte(name, '/'); idx >= 0 {
+			dir, name = name[:idx+1], name[idx+1:]
+		}
+	}
+	stem, ok = matchPattern(pattern, name)
+	if !ok || !strings.Contains(pattern, "%") {
+		return "", "", false
+	}
+	return stem, dir, true
+}
+
+// fileExists reports whether name exists relative to the Makefile's directory
+func (p *Parser) fileExists(name string) bool {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(p.makefile.Path), name)
+	}
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// mentioned reports whether name is a target or an explicit prerequisite,
+// which make treats as a file that "ought to exist"
+func (p *Parser) mentioned(name string) bool {
+	if _, ok := p.makefile.Targets[name]; ok {
+		return true
+	}
+	for _, t := range p.makefile.Targets {
+		if slices.Contains(t.Dependencies, name) || slices.Contains(t.OrderOnly, name) {
+			return true
+		}
+	}
+	return false
+}
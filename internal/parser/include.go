@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// parseInclude reads the files named by an include, -include or sinclude
+// directive in place, so their rules and variables merge in make's order.
+// Files that can't be read are diagnosed and skipped.
+func (p *Parser) parseInclude(directive, args string, lineNumber int) {
+	optional := directive != "include"
+	names := strings.Fields(p.expandText(args))
+	p.makefile.Includes = append(p.makefile.Includes, names...)
+
+	for _, name := range names {
+		paths := p.resolveInclude(name)
+		if len(paths) == 0 {
+			if !optional {
+				p.report(SeverityError, "missing-include", p.file, p.lineRange(p.file, lineNumber), "%s: No such file or directory", name)
+			}
+			continue
+		}
+		for _, path := range paths {
+			if isDependencyFile(path) {
+				if err := p.parseDependencyFile(path); err != nil {
+					p.report(SeverityError, "include-failed", p.file, p.lineRange(p.file, lineNumber), "%s: %v", path, err)
+				}
+				continue
+			}
+			if _, err := p.parseFile(path); err != nil {
+				p.report(SeverityError, "include-failed", p.file, p.lineRange(p.file, lineNumber), "%s: %v", path, err)
+			}
+		}
+	}
+}
+
+// resolveInclude finds the files an include name refers to. Relative names
+// are looked up next to the including file, then next to the top-level
+// Makefile, then in the include directories. Wildcards are expanded.
+func (p *Parser) resolveInclude(name string) []string {
+	var dirs []string
+	if filepath.IsAbs(name) {
+		dirs = []string{""}
+	} else {
+		dirs = append(dirs, filepath.Dir(p.file), filepath.Dir(p.makefile.Path))
+		dirs = append(dirs, p.includeDirs...)
+	}
+
+	for _, dir := range dirs {
+		candidate := name
+		if dir != "" {
+			candidate = filepath.Join(dir, name)
+		}
+		if strings.ContainsAny(name, "*?[") {
+			if matches, _ := filepath.Glob(candidate); len(matches) > 0 {
+				sort.Strings(matches)
+				return matches
+			}
+			continue
+		}
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return []string{candidate}
+		}
+	}
+	return nil
+}
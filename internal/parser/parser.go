@@ -2,58 +2,128 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 )
 
 var (
 	// Regular expressions for parsing
-	targetRegex   = regexp.MustCompile(`^([^#\s][^:=]*):(.*)$`)
-	variableRegex = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*([?:+]?=)\s*(.*)$`)
-	includeRegex  = regexp.MustCompile(`^-?include\s+(.+)$`)
+	variableRegex = regexp.MustCompile(`^((?:(?:export|override|private)\s+)*)((?:[^\s:#=+?!$]|\$\([^)]*\)|\$\{[^}]*\})+)\s*(:::=|::=|:=|\+=|\?=|!=|=)\s*(.*)$`)
+	includeRegex  = regexp.MustCompile(`^(include|-include|sinclude)\s+(.+)$`)
 	exportRegex   = regexp.MustCompile(`^export\s+([A-Za-z_][A-Za-z0-9_]*)`)
 	phonyRegex    = regexp.MustCompile(`^\.PHONY:\s*(.*)$`)
+	ifRegex       = regexp.MustCompile(`^(ifeq|ifneq|ifdef|ifndef)(?:\s+|\s*(?:[("']))`)
+	elseRegex     = regexp.MustCompile(`^else(?:\s+(.*))?$`)
+	endifRegex    = regexp.MustCompile(`^endif(?:\s.*)?$`)
+	defineRegex   = regexp.MustCompile(`^((?:(?:export|override)\s+)*)define\s+([^\s:+?!=]+)\s*(=|:=|::=|\+=|\?=|!=)?\s*$`)
+	endefRegex    = regexp.MustCompile(`^endef(?:\s.*)?$`)
+	undefineRegex = regexp.MustCompile(`^(?:override\s+)?undefine\s+(.+)$`)
 )
 
 // Parser is the main Makefile parser
 type Parser struct {
-	makefile *Makefile
-	phony    map[string]bool
+	makefile    *Makefile
+	phony       map[string]bool
+	conds       []*Conditional            // Stack of open conditional blocks
+	condBase    int                       // Depth of conds when the current file started
+	define      *defineBlock              // Open define ... endef block
+	file        string                    // File currently being read
+	including   []string                  // Absolute paths of files being read, outermost first
+	includeDirs []string                  // Extra include search directories, like make -I
+	allowShell  bool                      // Run $(shell ...) and != commands
+	reading     int                       // Nesting depth of parse, for $(eval ...)
+	sources     map[string]*syntaxScanner // Source of every file read, for diagnostic ranges
+	subParsers  map[string]*Parser        // Makefiles read by sub-makes, by absolute path
+}
+
+// defineBlock collects the body of a multi-line variable definition
+type defineBlock struct {
+	variable *Variable
+	operator string
+	depth    int // Nesting level of define blocks within the body
+	body     []string
 }
 
 // NewParser creates a new parser instance
 func NewParser() *Parser {
 	return &Parser{
 		makefile: &Makefile{
-			Targets:   make(map[string]*Target),
-			Variables: make(map[string]*Variable),
-			Includes:  []string{},
+			Targets:         make(map[string]*Target),
+			Variables:       make(map[string]*Variable),
+			TargetVariables: make(map[string][]*Variable),
+			Includes:        []string{},
+			Files:           []string{},
+			Phony:           []string{},
 		},
-		phony: make(map[string]bool),
+		phony:   make(map[string]bool),
+		sources: make(map[string]*syntaxScanner),
 	}
 }
 
-// ParseFile parses a Makefile from a file path
+// SetIncludeDirs sets the directories searched for included files,
+// like make's -I option
+func (p *Parser) SetIncludeDirs(dirs []string) {
+	p.includeDirs = dirs
+}
+
+// Makefile returns the Makefile model built so far
+func (p *Parser) Makefile() *Makefile {
+	return p.makefile
+}
+
+// ParseFile parses a Makefile from a file path, following include directives
 func (p *Parser) ParseFile(path string) (*Makefile, error) {
-	file, err := os.Open(path)
+	p.makefile.Path = path
+	return p.parseFile(path)
+}
+
+// parseFile reads one file into the Makefile model, either the top-level
+// Makefile or an included one
+func (p *Parser) parseFile(path string) (*Makefile, error) {
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to resolve path: %w", err)
+	}
+	for i, f := range p.including {
+		if f == abs {
+			chain := append(append([]string{}, p.including[i:]...), abs)
+			return nil, fmt.Errorf("include cycle detected: %s", strings.Join(chain, " -> "))
+		}
 	}
-	defer file.Close()
 
-	p.makefile.Path = path
-	return p.parse(file)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	p.sources[path] = newSyntaxScanner(src)
+
+	prevFile, prevBase := p.file, p.condBase
+	p.file, p.condBase = path, len(p.conds)
+	p.including = append(p.including, abs)
+	defer func() {
+		p.file, p.condBase = prevFile, prevBase
+		p.including = p.including[:len(p.including)-1]
+	}()
+
+	p.makefile.Files = append(p.makefile.Files, path)
+	return p.parse(bytes.NewReader(src))
 }
 
 // parse parses a Makefile from a reader
 func (p *Parser) parse(r io.Reader) (*Makefile, error) {
+	p.reading++
+	defer func() { p.reading-- }()
+
 	scanner := bufio.NewScanner(r)
 	lineNumber := 0
-	var currentTarget *Target
+	firstLine := 0 // First physical line of the current logical line
+	var currentRule *ruleContext
 	var lastComment string
 	var continuedLine string
 
@@ -61,7 +131,16 @@ func (p *Parser) parse(r io.Reader) (*Makefile, error) {
 		lineNumber++
 		line := scanner.Text()
 
+		// Lines inside define ... endef are kept verbatim
+		if p.define != nil {
+			p.parseDefineLine(line)
+			continue
+		}
+
 		// Handle line continuations
+		if continuedLine == "" {
+			firstLine = lineNumber
+		}
 		if strings.HasSuffix(line, "\\") {
 			continuedLine += strings.TrimSuffix(line, "\\") + " "
 			continue
@@ -71,10 +150,26 @@ func (p *Parser) parse(r io.Reader) (*Makefile, error) {
 			continuedLine = ""
 		}
 
-		// Skip empty lines
+		// If we're in a rule and the line starts with a tab, it's a command
+		if currentRule != nil && strings.HasPrefix(line, "\t") {
+			if (currentRule.active && p.active()) || currentRule.condition == p.currentBranch() {
+				p.addCommand(currentRule, strings.TrimPrefix(line, "\t"))
+			}
+			if currentRule.active && p.active() {
+				p.checkReferences(line, firstLine)
+			}
+			continue
+		}
+
+		// Skip empty lines, which don't end the recipe of the current rule
+		raw := line
 		line = strings.TrimSpace(line)
 		if line == "" {
-			currentTarget = nil
+			continue
+		}
+
+		// Conditional directives don't end the current rule
+		if p.parseConditional(line, firstLine) {
 			continue
 		}
 
@@ -84,139 +179,178 @@ func (p *Parser) parse(r io.Reader) (*Makefile, error) {
 			continue
 		}
 
+		// Directives in branches make would skip have no effect
+		active := p.active()
+		if active {
+			content := raw
+			if c := commentIndex(raw, 0); c >= 0 {
+				content = raw[:c]
+			}
+			p.checkReferences(content, firstLine)
+		}
+
+		// Multi-line variables are read even in skipped branches to find endef
+		if matches := defineRegex.FindStringSubmatch(stripComment(line)); matches != nil {
+			prefixes := strings.Fields(matches[1])
+			p.define = &defineBlock{
+				variable: &Variable{
+					Name:        matches[2],
+					IsExported:  slices.Contains(prefixes, "export"),
+					IsOverride:  slices.Contains(prefixes, "override"),
+					IsMultiline: true,
+					File:        p.file,
+					LineNumber:  firstLine,
+					Condition:   p.currentBranch(),
+				},
+				operator: matches[3],
+			}
+			currentRule = nil
+			lastComment = ""
+			continue
+		}
+
+		// An endef without a define ends nothing
+		if endefRegex.MatchString(stripComment(line)) {
+			if active {
+				p.report(SeverityError, "extraneous-endef", p.file, p.lineRange(p.file, firstLine), "extraneous 'endef'")
+			}
+			currentRule = nil
+			continue
+		}
+
+		// Check for undefine directives
+		if matches := undefineRegex.FindStringSubmatch(stripComment(line)); matches != nil {
+			if !active {
+				continue
+			}
+			for _, name := range strings.Fields(p.expandText(matches[1])) {
+				delete(p.makefile.Variables, name)
+			}
+			currentRule = nil
+			continue
+		}
+
 		// Check for .PHONY targets
 		if matches := phonyRegex.FindStringSubmatch(line); matches != nil {
-			phonyTargets := strings.Fields(matches[1])
+			if !active {
+				continue
+			}
+			phonyTargets := strings.Fields(p.expandText(matches[1]))
 			for _, t := range phonyTargets {
+				if !p.phony[t] {
+					p.makefile.Phony = append(p.makefile.Phony, t)
+				}
 				p.phony[t] = true
+				// .PHONY may come after the rule it applies to
+				if target, ok := p.makefile.Targets[t]; ok {
+					target.IsPhony = true
+				}
 			}
 			continue
 		}
 
 		// Check for include directives
 		if matches := includeRegex.FindStringSubmatch(line); matches != nil {
-			includes := strings.Fields(matches[1])
-			p.makefile.Includes = append(p.makefile.Includes, includes...)
+			if !active {
+				continue
+			}
+			p.parseInclude(matches[1], stripComment(matches[2]), firstLine)
+			currentRule = nil
+			continue
+		}
+
+		// Check for variable assignments
+		if matches := variableRegex.FindStringSubmatch(line); matches != nil {
+			prefixes := strings.Fields(matches[1])
+			p.setVariable(&Variable{
+				Name:       strings.TrimSpace(p.expandText(matches[2])),
+				IsExported: slices.Contains(prefixes, "export"),
+				IsOverride: slices.Contains(prefixes, "override"),
+				IsPrivate:  slices.Contains(prefixes, "private"),
+				File:       p.file,
+				LineNumber: firstLine,
+				Condition:  p.currentBranch(),
+			}, matches[3], stripComment(matches[4]))
+			currentRule = nil
 			continue
 		}
 
 		// Check for export directives
 		if matches := exportRegex.FindStringSubmatch(line); matches != nil {
+			if !active {
+				continue
+			}
 			if v, ok := p.makefile.Variables[matches[1]]; ok {
 				v.IsExported = true
 			}
 			continue
 		}
 
-		// Check for variable assignments
-		if matches := variableRegex.FindStringSubmatch(line); matches != nil {
-			varType := SimpleAssignment
-			switch matches[2] {
-			case ":=":
-				varType = RecursiveAssignment
-			case "?=":
-				varType = ConditionalAssignment
-			case "+=":
-				varType = AppendAssignment
-			}
-
-			var value string
-			if varType == AppendAssignment {
-				if existing, ok := p.makefile.Variables[matches[1]]; ok {
-					value = existing.Value + " " + matches[3]
-				} else {
-					value = matches[3]
-				}
-			} else {
-				value = matches[3]
-			}
-
-			p.makefile.Variables[matches[1]] = &Variable{
-				Name:       matches[1],
-				Value:      value,
-				Type:       varType,
-				LineNumber: lineNumber,
-			}
-			currentTarget = nil
+		// Check for target- and pattern-specific variables
+		if p.parseTargetVariable(line, firstLine) {
+			currentRule = nil
 			continue
 		}
 
-		// Check for targets
-		if matches := targetRegex.FindStringSubmatch(line); matches != nil {
-			targetNames := strings.Fields(matches[1])
-			deps := strings.Fields(matches[2])
-
-			for _, targetName := range targetNames {
-				target := &Target{
-					Name:         targetName,
-					Dependencies: deps,
-					Commands:     []string{},
-					IsPhony:      p.phony[targetName],
-					Description:  lastComment,
-					LineNumber:   lineNumber,
-				}
-				p.makefile.Targets[targetName] = target
-				currentTarget = target
-			}
+		// Check for rules
+		if rule := p.parseRule(line, firstLine, lastComment); rule != nil {
+			currentRule = rule
 			lastComment = ""
 			continue
 		}
 
-		// If we're in a target and the line starts with a tab, it's a command
-		if currentTarget != nil && strings.HasPrefix(scanner.Text(), "\t") {
-			command := strings.TrimPrefix(scanner.Text(), "\t")
-			currentTarget.Commands = append(currentTarget.Commands, command)
-			continue
+		// Other lines such as $(eval ...) or $(info ...) are expanded for
+		// their effects, and make rejects any that leave text behind
+		if active && !directiveRegex.MatchString(line) {
+			p.checkSeparator(raw, p.expandText(line), firstLine, currentRule != nil)
 		}
 
-		// Reset current target if we hit a non-command line
-		currentTarget = nil
+		// Reset current rule if we hit a non-command line
+		currentRule = nil
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
+	if p.define != nil {
+		p.report(SeverityError, "unterminated-define", p.file, p.lineRange(p.file, p.define.variable.LineNumber), "missing 'endef', unterminated 'define'")
+		p.define = nil
+	}
+	for len(p.conds) > p.condBase {
+		block := p.conds[len(p.conds)-1]
+		p.report(SeverityError, "missing-endif", p.file, p.lineRange(p.file, block.LineNumber), "missing 'endif'")
+		p.conds = p.conds[:len(p.conds)-1]
+	}
+
 	return p.makefile, nil
 }
 
-// ExpandVariable expands a variable with all its references resolved
-func (p *Parser) ExpandVariable(name string) (string, error) {
-	visited := make(map[string]bool)
-	return p.expandVariableRecursive(name, visited)
-}
+// eval reads text as Makefile content, for the $(eval ...) function
+func (p *Parser) eval(text string) error {
+	prevBase, prevDefine := p.condBase, p.define
+	p.condBase, p.define = len(p.conds), nil
+	defer func() { p.condBase, p.define = prevBase, prevDefine }()
 
-func (p *Parser) expandVariableRecursive(name string, visited map[string]bool) (string, error) {
-	if visited[name] {
-		return "", fmt.Errorf("circular reference detected for variable: %s", name)
-	}
+	_, err := p.parse(strings.NewReader(text))
+	return err
+}
 
-	variable, ok := p.makefile.Variables[name]
-	if !ok {
-		// Check environment variables
-		if envVal := os.Getenv(name); envVal != "" {
-			return envVal, nil
+// parseDefineLine handles one line of a define ... endef body
+func (p *Parser) parseDefineLine(line string) {
+	trimmed := strings.TrimSpace(line)
+	if defineRegex.MatchString(stripComment(trimmed)) {
+		p.define.depth++
+	} else if endefRegex.MatchString(trimmed) {
+		if p.define.depth == 0 {
+			block := p.define
+			p.define = nil
+			p.setVariable(block.variable, block.operator, strings.Join(block.body, "\n"))
+			return
 		}
-		return "", fmt.Errorf("variable not found: %s", name)
+		p.define.depth--
 	}
-
-	visited[name] = true
-	defer delete(visited, name)
-
-	// Expand variable references in the value
-	value := variable.Value
-	varRefRegex := regexp.MustCompile(`\$\(([^)]+)\)|\$\{([^}]+)\}`)
-	
-	expandedValue := varRefRegex.ReplaceAllStringFunc(value, func(match string) string {
-		// Extract variable name from $(VAR) or ${VAR}
-		varName := match[2 : len(match)-1]
-		if expanded, err := p.expandVariableRecursive(varName, visited); err == nil {
-			return expanded
-		}
-		return match // Keep original if expansion fails
-	})
-
-	return expandedValue, nil
+	p.define.body = append(p.define.body, line)
 }
 
 // BuildDependencyGraph builds a dependency graph for all targets
@@ -227,17 +361,26 @@ func (p *Parser) BuildDependencyGraph() *DependencyGraph {
 
 	// Create nodes for all targets
 	for name, target := range p.makefile.Targets {
+		generated := target.GeneratedDependencies()
 		node := &DependencyNode{
 			Name:         name,
-			Dependencies: target.Dependencies,
+			Dependencies: []string{},
+			OrderOnly:    target.OrderOnly,
+			Generated:    generated,
 			Dependents:   []string{},
 		}
+		for _, dep := range target.Dependencies {
+			if !slices.Contains(generated, dep) {
+				node.Dependencies = append(node.Dependencies, dep)
+			}
+		}
 		graph.Nodes[name] = node
 	}
 
 	// Build reverse dependencies (dependents)
 	for name, node := range graph.Nodes {
-		for _, dep := range node.Dependencies {
+		deps := appendUnique(append([]string{}, node.Dependencies...), node.Generated...)
+		for _, dep := range appendUnique(deps, node.OrderOnly...) {
 			if depNode, ok := graph.Nodes[dep]; ok {
 				depNode.Dependents = append(depNode.Dependents, name)
 			}
@@ -256,7 +399,7 @@ func (p *Parser) GetTargetDependencies(targetName string, maxDepth int) ([]strin
 
 	visited := make(map[string]bool)
 	deps := []string{}
-	
+
 	var collectDeps func(name string, depth int)
 	collectDeps = func(name string, depth int) {
 		if depth > maxDepth || visited[name] {
@@ -265,7 +408,7 @@ func (p *Parser) GetTargetDependencies(targetName string, maxDepth int) ([]strin
 		visited[name] = true
 
 		if t, ok := p.makefile.Targets[name]; ok {
-			for _, dep := range t.Dependencies {
+			for _, dep := range appendUnique(append([]string{}, t.Dependencies...), t.OrderOnly...) {
 				if !visited[dep] {
 					deps = append(deps, dep)
 					collectDeps(dep, depth+1)
@@ -278,13 +421,28 @@ func (p *Parser) GetTargetDependencies(targetName string, maxDepth int) ([]strin
 	return deps, nil
 }
 
-// FindMakefiles finds all Makefiles in a directory tree
-func FindMakefiles(root string, pattern string) ([]string, error) {
+// defaultMakefilePattern matches the files FindMakefiles looks for when no
+// pattern is given
+const defaultMakefilePattern = "Makefile|makefile|GNUmakefile|*.mk"
+
+// IsMakefile reports whether FindMakefiles would list the file at path for
+// pattern, a '|' separated list of names or globs. An empty pattern
+// matches common Makefile names.
+func IsMakefile(path string, pattern string) bool {
 	if pattern == "" {
-		pattern = "Makefile|makefile|GNUmakefile|*.mk"
+		pattern = defaultMakefilePattern
+	}
+	base := filepath.Base(path)
+	for _, p := range strings.Split(pattern, "|") {
+		if matched, _ := filepath.Match(p, base); matched || base == p {
+			return true
+		}
 	}
+	return false
+}
 
-	patterns := strings.Split(pattern, "|")
+// FindMakefiles finds all Makefiles in a directory tree
+func FindMakefiles(root string, pattern string) ([]string, error) {
 	makefiles := []string{}
 
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
@@ -296,16 +454,12 @@ func FindMakefiles(root string, pattern string) ([]string, error) {
 			return nil
 		}
 
-		base := filepath.Base(path)
-		for _, p := range patterns {
-			if matched, _ := filepath.Match(p, base); matched || base == p {
-				makefiles = append(makefiles, path)
-				break
-			}
+		if IsMakefile(path, pattern) {
+			makefiles = append(makefiles, path)
 		}
 
 		return nil
 	})
 
 	return makefiles, err
-}
\ No newline at end of file
+}
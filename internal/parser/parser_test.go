@@ -1,8 +1,14 @@
 package parser
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseFile(t *testing.T) {
@@ -55,7 +61,7 @@ func TestParseFile(t *testing.T) {
 
 func TestExpandVariable(t *testing.T) {
 	parser := NewParser()
-	
+
 	// Create a simple makefile with variable references
 	mf := &Makefile{
 		Variables: map[string]*Variable{
@@ -136,4 +142,1325 @@ func TestGetTargetDependencies(t *testing.T) {
 	if len(deps) < 4 {
 		t.Errorf("Expected at least 4 dependencies, got %d", len(deps))
 	}
-}
\ No newline at end of file
+}
+
+func TestParseConditionals(t *testing.T) {
+	parser := NewParser()
+	testFile := filepath.Join("testdata", "conditional.mk")
+
+	mf, err := parser.ParseFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	// Only the active branch should define variables
+	if rm, ok := mf.Variables["RM"]; !ok || rm.Value != "rm -f" {
+		t.Errorf("Expected RM='rm -f' from the linux branch, got %+v", rm)
+	}
+
+	clean, ok := mf.Targets["clean"]
+	if !ok {
+		t.Fatal("Target 'clean' not found")
+	}
+	if clean.Description != "Clean on Linux" {
+		t.Errorf("Expected description 'Clean on Linux', got '%s'", clean.Description)
+	}
+	if clean.Condition == nil || clean.Condition.String() != `ifeq "$(PLATFORM)" "linux"` {
+		t.Errorf("Expected 'clean' under the linux branch, got %v", clean.Condition)
+	}
+
+	// Conditionals inside a recipe select command lines
+	build := mf.Targets["build"]
+	expectedCommands := []string{"cc -o app$(EXT) main.c", "@echo debug build", "@echo not a release"}
+	if len(build.Commands) != len(expectedCommands) {
+		t.Fatalf("Expected commands %v, got %v", expectedCommands, build.Commands)
+	}
+	for i, cmd := range expectedCommands {
+		if build.Commands[i] != cmd {
+			t.Errorf("Expected command %q, got %q", cmd, build.Commands[i])
+		}
+	}
+
+	if _, ok := mf.Targets["debug-extra"]; ok {
+		t.Error("Target 'debug-extra' from an inactive branch should not be defined")
+	}
+	if debug, ok := mf.Targets["debug"]; !ok || debug.Condition.Kind != IfNeq {
+		t.Error("Target 'debug' should be defined under ifneq")
+	}
+
+	// The conditional tree keeps inactive definitions
+	if len(mf.Conditionals) != 4 {
+		t.Fatalf("Expected 4 top-level conditionals, got %d", len(mf.Conditionals))
+	}
+	platform := mf.Conditionals[0]
+	if len(platform.Branches) != 3 {
+		t.Fatalf("Expected 3 branches, got %d", len(platform.Branches))
+	}
+	windows := platform.Branches[0]
+	if windows.Active || len(windows.Targets) != 1 || len(windows.Targets[0].Commands) != 1 {
+		t.Errorf("Expected inactive windows branch with one clean rule, got %+v", windows)
+	}
+	nested := mf.Conditionals[3].Branches[0].Nested
+	if len(nested) != 1 || nested[0].Branches[0].Active {
+		t.Error("Expected one inactive nested conditional")
+	}
+}
+
+func TestParseConditionalEval(t *testing.T) {
+	// $(eval ...) in a condition runs where the directive appears
+	tests := []struct {
+		input    string
+		variable string
+		value    string
+		active   []bool
+	}{
+		{"ifeq ($(eval X := 1),)\nY := $(X)\nendif\n", "Y", "1", []bool{true}},
+		{"ifdef $(eval X := 2)X\nY := $(X)\nendif\n", "Y", "2", []bool{true}},
+		{"ifeq (a,b)\nelse ifeq ($(eval X := 3),)\nY := $(X)\nendif\n", "Y", "3", []bool{false, true}},
+		{"ifeq (a,b)\nifeq ($(eval X := 4),)\nendif\nendif\n", "X", "", []bool{false}},
+	}
+	for _, tt := range tests {
+		parser := NewParser()
+		mf, err := parser.parse(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%q: failed to parse: %v", tt.input, err)
+			continue
+		}
+		if len(mf.Diagnostics) != 0 {
+			t.Errorf("%q: expected no diagnostics, got %v", tt.input, mf.Diagnostics)
+		}
+		value := ""
+		if v, ok := mf.Variables[tt.variable]; ok {
+			value = v.Value
+		}
+		if value != tt.value {
+			t.Errorf("%q: expected %s to be %q, got %q", tt.input, tt.variable, tt.value, value)
+		}
+		active := []bool{}
+		for _, branch := range mf.Conditionals[0].Branches {
+			active = append(active, branch.Active)
+		}
+		if !slices.Equal(active, tt.active) {
+			t.Errorf("%q: expected active branches %v, got %v", tt.input, tt.active, active)
+		}
+	}
+}
+
+func TestParseDirectiveErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+		line  int
+	}{
+		{"ifdef FOO\nall:\n", "missing-endif", 1},
+		{"endif\n", "extraneous-endif", 1},
+		{"else\n", "extraneous-else", 1},
+		{"ifeq (a,b)\nelse\nelse\nendif\n", "duplicate-else", 3},
+		{"ifeq (a b)\nendif\n", "invalid-conditional", 1},
+		{"define FOO\nbody\n", "unterminated-define", 1},
+		{"endef\n", "extraneous-endef", 1},
+	}
+	for _, tt := range tests {
+		parser := NewParser()
+		mf, err := parser.parse(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%q: expected recovery, got %v", tt.input, err)
+			continue
+		}
+		if len(mf.Diagnostics) != 1 || mf.Diagnostics[0].Code != tt.code || mf.Diagnostics[0].Range.Start.Line != tt.line {
+			t.Errorf("%q: expected %s at line %d, got %v", tt.input, tt.code, tt.line, mf.Diagnostics)
+		}
+		if mf.Diagnostics[0].Severity != SeverityError {
+			t.Errorf("%q: expected an error, got a %s", tt.input, mf.Diagnostics[0].Severity)
+		}
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	path := filepath.Join("testdata", "diagnostics.mk")
+	mf, err := NewParser().ParseFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	expected := []struct {
+		severity Severity
+		code     string
+		start    Position
+		end      Position
+		message  string
+	}{
+		{SeverityError, "missing-separator", Position{Offset: 67, Line: 5, Column: 5}, Position{Offset: 86, Line: 5, Column: 24}, "missing separator (did you mean TAB instead of 4 spaces?)"},
+		{SeverityError, "recipe-before-target", Position{Offset: 89, Line: 7, Column: 2}, Position{Offset: 100, Line: 7, Column: 13}, "recipe commences before first target"},
+		{SeverityError, "unterminated-reference", Position{Offset: 110, Line: 8, Column: 10}, Position{Offset: 114, Line: 8, Column: 14}, "unterminated variable reference"},
+		{SeverityError, "missing-separator", Position{Offset: 115, Line: 9, Column: 1}, Position{Offset: 125, Line: 9, Column: 11}, "missing separator"},
+		{SeverityWarning, "extraneous-text", Position{Offset: 175, Line: 14, Column: 1}, Position{Offset: 185, Line: 14, Column: 11}, "extraneous text after 'else' directive"},
+	}
+	if len(mf.Diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(mf.Diagnostics), mf.Diagnostics)
+	}
+	for i, want := range expected {
+		d := mf.Diagnostics[i]
+		if d.Severity != want.severity || d.Code != want.code || d.Message != want.message || d.File != path {
+			t.Errorf("Diagnostic %d: expected %s %s %q, got %s %s %q", i, want.severity, want.code, want.message, d.Severity, d.Code, d.Message)
+		}
+		if d.Range.Start != want.start || d.Range.End != want.end {
+			t.Errorf("Diagnostic %d: expected range %+v-%+v, got %+v-%+v", i, want.start, want.end, d.Range.Start, d.Range.End)
+		}
+	}
+
+	// Reading goes on after each problem
+	for _, name := range []string{"build", "test", "all"} {
+		if _, ok := mf.Targets[name]; !ok {
+			t.Errorf("Expected target '%s' after recovery", name)
+		}
+	}
+	if commands := mf.Targets["test"].Commands; len(commands) != 1 || commands[0] != "./app" {
+		t.Errorf("Expected the recipe of 'test' to be kept, got %q", commands)
+	}
+}
+
+func TestParseDefine(t *testing.T) {
+	parser := NewParser()
+	testFile := filepath.Join("testdata", "define.mk")
+
+	mf, err := parser.ParseFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	script, ok := mf.Variables["RELEASE_SCRIPT"]
+	if !ok {
+		t.Fatal("Variable 'RELEASE_SCRIPT' not found")
+	}
+	expected := "\t@echo \"releasing $(VERSION)\"\n\tgit tag v$(VERSION) \\\n\t\t-m \"release\""
+	if script.Value != expected {
+		t.Errorf("Expected body %q, got %q", expected, script.Value)
+	}
+	if !script.IsMultiline || script.LineNumber != 4 {
+		t.Errorf("Expected multi-line variable at line 4, got %+v", script)
+	}
+
+	if greeting := mf.Variables["GREETING"]; greeting == nil || greeting.Value != "hello world" {
+		t.Errorf("Expected GREETING='hello world', got %+v", greeting)
+	}
+
+	outer, ok := mf.Variables["OUTER"]
+	if !ok {
+		t.Fatal("Variable 'OUTER' not found")
+	}
+	if outer.Value != "define INNER\nnested body\nendef" || !outer.IsExported {
+		t.Errorf("Expected exported OUTER with nested define body, got %+v", outer)
+	}
+	if _, ok := mf.Variables["INNER"]; ok {
+		t.Error("Nested define should not be defined until OUTER is expanded")
+	}
+
+	if _, ok := mf.Variables["TEMP"]; ok {
+		t.Error("Variable 'TEMP' should have been undefined")
+	}
+
+	// The body must not leak into targets
+	if len(mf.Targets) != 1 {
+		t.Errorf("Expected only the 'release' target, got %d targets", len(mf.Targets))
+	}
+}
+
+func TestParseIncludes(t *testing.T) {
+	parser := NewParser()
+	parser.SetIncludeDirs([]string{filepath.Join("testdata", "include", "extra")})
+	testFile := filepath.Join("testdata", "include", "Makefile")
+
+	mf, err := parser.ParseFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	lint, ok := mf.Targets["lint"]
+	if !ok {
+		t.Fatal("Target 'lint' from common.mk not found")
+	}
+	if lint.File != filepath.Join("testdata", "include", "mk", "common.mk") {
+		t.Errorf("Expected 'lint' from common.mk, got %s", lint.File)
+	}
+	if lint.Description != "Run the linter" {
+		t.Errorf("Expected description 'Run the linter', got '%s'", lint.Description)
+	}
+	if build := mf.Targets["build"]; build == nil || build.File != testFile {
+		t.Errorf("Expected 'build' from the root Makefile, got %+v", build)
+	}
+
+	// Later definitions win in make's reading order
+	if cc := mf.Variables["CC"]; cc == nil || cc.Value != "clang" {
+		t.Errorf("Expected CC=clang from common.mk, got %+v", cc)
+	}
+	if local := mf.Variables["LOCAL"]; local == nil || local.File != filepath.Join("testdata", "include", "mk", "local.mk") {
+		t.Errorf("Expected LOCAL from mk/local.mk, got %+v", local)
+	}
+	if _, ok := mf.Variables["EXTRA"]; !ok {
+		t.Error("Variable 'EXTRA' from the include directory not found")
+	}
+
+	expectedFiles := 4
+	if len(mf.Files) != expectedFiles {
+		t.Errorf("Expected %d files read, got %v", expectedFiles, mf.Files)
+	}
+}
+
+func TestParseIncludeErrors(t *testing.T) {
+	mf, err := NewParser().ParseFile(filepath.Join("testdata", "include", "cycle-a.mk"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if len(mf.Diagnostics) != 1 || !strings.Contains(mf.Diagnostics[0].Message, "include cycle detected") {
+		t.Errorf("Expected include cycle diagnostic, got %v", mf.Diagnostics)
+	}
+
+	// extra.mk is only found through the include directories
+	mf, err = NewParser().ParseFile(filepath.Join("testdata", "include", "Makefile"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if len(mf.Diagnostics) != 1 || mf.Diagnostics[0].Code != "missing-include" ||
+		!strings.Contains(mf.Diagnostics[0].Message, "extra.mk: No such file or directory") {
+		t.Errorf("Expected missing include diagnostic, got %v", mf.Diagnostics)
+	}
+	// The rest of the Makefile is still read
+	if _, ok := mf.Targets["build"]; !ok {
+		t.Error("Expected 'build' after the missing include")
+	}
+}
+
+func TestParsePatternRules(t *testing.T) {
+	parser := NewParser()
+	testFile := filepath.Join("testdata", "pattern", "Makefile")
+
+	mf, err := parser.ParseFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	if _, ok := mf.Targets["%.o"]; ok {
+		t.Errorf("Pattern rule '%s' should not be a target", "%.o")
+	}
+	if len(mf.PatternRules) != 4 {
+		t.Fatalf("Expected 4 pattern rules, got %d", len(mf.PatternRules))
+	}
+	compile := mf.PatternRules[0]
+	if compile.String() != "%.o: %.c" || compile.Description != "Compile C sources" {
+		t.Errorf("Unexpected first pattern rule %+v", compile)
+	}
+	if asm := mf.PatternRules[2]; len(asm.Commands) != 1 || asm.Commands[0] != "$(CC) -S $<" {
+		t.Errorf("Expected inline recipe for %%.s, got %v", asm.Commands)
+	}
+
+	// Static pattern rules expand into explicit targets
+	main, ok := mf.Targets["main.o"]
+	if !ok {
+		t.Fatal("Target 'main.o' from static pattern rule not found")
+	}
+	if main.Stem != "main" || main.StaticPattern == nil || main.StaticPattern.String() != "%.o: %.h" {
+		t.Errorf("Expected static pattern %%.o: %%.h with stem main, got %+v", main)
+	}
+	if len(main.Dependencies) != 1 || main.Dependencies[0] != "main.h" {
+		t.Errorf("Expected dependency main.h, got %v", main.Dependencies)
+	}
+
+	// Prerequisites are expanded when the rule is read
+	if app := mf.Targets["app"]; app == nil || len(app.Dependencies) != 4 {
+		t.Errorf("Expected 4 expanded dependencies for 'app', got %+v", app)
+	}
+}
+
+func TestFindImplicitRule(t *testing.T) {
+	parser := NewParser()
+	if _, err := parser.ParseFile(filepath.Join("testdata", "pattern", "Makefile")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	tests := []struct {
+		target string
+		rule   string
+		stem   string
+		deps   []string
+	}{
+		{"util.o", "%.o: %.c", "util", []string{"util.c"}},
+		{"src/lib.o", "%.o: %.c", "src/lib", []string{"src/lib.c"}},
+		{"gen/api.pb.c", "gen/%.pb.c: proto/%.proto", "api", []string{"proto/api.proto"}},
+		{"main.s", "%.s: %.c", "main", []string{"main.c"}},
+	}
+	for _, tt := range tests {
+		match, ok := parser.FindImplicitRule(tt.target)
+		if !ok {
+			t.Errorf("Expected implicit rule for %s", tt.target)
+			continue
+		}
+		if match.Rule.String() != tt.rule || match.Stem != tt.stem {
+			t.Errorf("%s: expected %s with stem %s, got %s with stem %s", tt.target, tt.rule, tt.stem, match.Rule, match.Stem)
+		}
+		if strings.Join(match.Dependencies, " ") != strings.Join(tt.deps, " ") {
+			t.Errorf("%s: expected prerequisites %v, got %v", tt.target, tt.deps, match.Dependencies)
+		}
+	}
+
+	// gen/api.pb.o needs gen/api.pb.c, which is made by a chained rule
+	match, ok := parser.FindImplicitRule("gen/api.pb.o")
+	if !ok || len(match.Chain) != 1 || match.Chain[0].Rule.String() != "gen/%.pb.c: proto/%.proto" {
+		t.Errorf("Expected chained implicit rule for gen/api.pb.o, got %+v", match)
+	}
+
+	if _, ok := parser.FindImplicitRule("missing.o"); ok {
+		t.Error("Expected no implicit rule for missing.o without missing.c")
+	}
+}
+
+func TestVariableFlavors(t *testing.T) {
+	parser := NewParser()
+	mf, err := parser.ParseFile(filepath.Join("testdata", "flavor.mk"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		typ      VariableType
+		flavor   VariableFlavor
+		value    string
+		expanded string
+	}{
+		{"RECURSIVE", RecursiveAssignment, RecursiveFlavor, "$(BASE)/bin", "/opt/bin"},
+		{"SIMPLE", SimpleAssignment, SimpleFlavor, "/usr/bin", "/usr/bin"},
+		{"POSIX", SimpleAssignment, SimpleFlavor, "/usr/lib", "/usr/lib"},
+		{"IMMEDIATE", ImmediateAssignment, RecursiveFlavor, "/usr/share", "/usr/share"},
+		{"DEFAULTED", ConditionalAssignment, RecursiveFlavor, "first", "first"},
+		{"RFLAGS", AppendAssignment, RecursiveFlavor, "-O2 $(LEVEL)", "-O2 -g"},
+		{"SFLAGS", AppendAssignment, SimpleFlavor, "-O2 ", "-O2 "},
+		{"LOCKED", SimpleAssignment, SimpleFlavor, "fixed", "fixed"},
+		{"TOKEN", RecursiveAssignment, RecursiveFlavor, "secret ", "secret "},
+		{"HASH", SimpleAssignment, SimpleFlavor, "a#b", "a#b"},
+		{"NOW", ShellAssignment, RecursiveFlavor, "$(shell date)", "$(shell date)"},
+		{"SPACED", RecursiveAssignment, RecursiveFlavor, "foo ", "foo "},
+		{"JOINED", SimpleAssignment, SimpleFlavor, "foo x", "foo x"},
+	}
+	for _, tt := range tests {
+		v, ok := mf.Variables[tt.name]
+		if !ok {
+			t.Errorf("Variable '%s' not found", tt.name)
+			continue
+		}
+		if v.Type != tt.typ || v.Flavor != tt.flavor {
+			t.Errorf("%s: expected %s/%s, got %s/%s", tt.name, tt.typ, tt.flavor, v.Type, v.Flavor)
+		}
+		if v.Value != tt.value {
+			t.Errorf("%s: expected value %q, got %q", tt.name, tt.value, v.Value)
+		}
+		expanded, err := parser.ExpandVariable(tt.name)
+		if err != nil {
+			t.Errorf("%s: failed to expand: %v", tt.name, err)
+		} else if expanded != tt.expanded {
+			t.Errorf("%s: expected expansion %q, got %q", tt.name, tt.expanded, expanded)
+		}
+	}
+
+	if !mf.Variables["TOKEN"].IsExported || !mf.Variables["LOCKED"].IsOverride {
+		t.Error("Expected export and override prefixes to be recorded")
+	}
+	if raw := mf.Variables["SIMPLE"].RawValue; raw != "$(BASE)/bin" {
+		t.Errorf("Expected raw value '$(BASE)/bin', got %q", raw)
+	}
+}
+
+func TestExpandFunctions(t *testing.T) {
+	parser := NewParser()
+	mf, err := parser.ParseFile(filepath.Join("testdata", "functions", "Makefile"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	tests := map[string]string{
+		"SRCS":       "src/main.c src/util.c src/sub/extra.c",
+		"OBJS":       "build/main.o build/util.o build/sub/extra.o",
+		"NAMES":      "main util extra",
+		"DIRS":       "src/ src/sub/",
+		"HEADERS":    "include/main.h include/util.h include/extra.h",
+		"MAINS":      "src/main.c",
+		"OTHERS":     "src/util.c src/sub/extra.c",
+		"UPPER":      "bAnAnA",
+		"COUNT":      "3",
+		"SECOND":     "src/util.c",
+		"FIRST_TWO":  "src/main.c src/util.c",
+		"JOINED":     "a1 b2 c",
+		"STRIPPED":   "a b",
+		"FOUND":      "an",
+		"SUFFIXES":   ".c .c .c",
+		"LAST":       "src/sub/extra.c",
+		"MODE":       "debug",
+		"NOMODE":     "release",
+		"EITHER":     "fallback",
+		"BOTH":       "1",
+		"LOOP":       "item1 item2 item3",
+		"LET":        "b c-a",
+		"GREETING":   "Hello, Alice and Bob!",
+		"REVERSED":   "c b a",
+		"ORIGIN":     "file undefined",
+		"FLAVOR":     "simple recursive",
+		"RAW":        "$(if $(DEBUG),debug,release)",
+		"NESTED":     "src/main.o src/util.o src/sub/extra.o",
+		"SUBST_OBJS": "src/main.o src/util.o src/sub/extra.o",
+		"PAT_OBJS":   "out/main.o out/util.o out/sub/extra.o",
+		"BRACES":     "BAnAnA",
+		"ESCAPED":    "cost: $5",
+		"SHELL_OUT":  "$(shell echo hi)",
+	}
+	for name, expected := range tests {
+		expanded, err := parser.ExpandVariable(name)
+		if err != nil {
+			t.Errorf("%s: failed to expand: %v", name, err)
+			continue
+		}
+		if expanded != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, expanded)
+		}
+	}
+
+	// $(eval) defines rules and variables while the Makefile is read
+	for _, prog := range []string{"server", "client"} {
+		target, ok := mf.Targets[prog]
+		if !ok {
+			t.Errorf("Target '%s' from $(eval) not found", prog)
+			continue
+		}
+		if len(target.Dependencies) != 1 || target.Dependencies[0] != prog+".o" {
+			t.Errorf("Expected '%s' to depend on %s.o, got %v", prog, prog, target.Dependencies)
+		}
+		if len(target.Commands) != 1 || target.Commands[0] != "$(CC) -o $@ $^" {
+			t.Errorf("Unexpected commands for '%s': %v", prog, target.Commands)
+		}
+		if v, ok := mf.Variables[prog+"_BUILT"]; !ok || v.Value != "yes" {
+			t.Errorf("Expected %s_BUILT=yes from $(eval)", prog)
+		}
+	}
+
+	if _, err := parser.ExpandVariable("FAIL"); err == nil || err.Error() != "something went wrong" {
+		t.Errorf("Expected $(error) to fail expansion, got %v", err)
+	}
+
+	parser.SetAllowShell(true)
+	if expanded, err := parser.ExpandVariable("SHELL_OUT"); err != nil || expanded != "hi" {
+		t.Errorf("Expected shell output 'hi', got %q (%v)", expanded, err)
+	}
+}
+
+func TestExpandRecipe(t *testing.T) {
+	parser := NewParser()
+	if _, err := parser.ParseFile(filepath.Join("testdata", "pattern", "Makefile")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	tests := map[string][]string{
+		"app":          {"gcc -o app main.o util.o src/lib.o gen/api.pb.o"},
+		"util.o":       {"gcc -c util.c -o util.o"},
+		"src/lib.o":    {"gcc -c src/lib.c -o src/lib.o"},
+		"gen/api.pb.c": {"protoc --c_out=gen -I proto api.proto # api"},
+	}
+	for target, expected := range tests {
+		commands, err := parser.ExpandRecipe(target)
+		if err != nil {
+			t.Errorf("%s: failed to expand recipe: %v", target, err)
+			continue
+		}
+		if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%s: expected %q, got %q", target, expected, commands)
+		}
+	}
+
+	if _, err := parser.ExpandRecipe("missing.o"); err == nil {
+		t.Error("Expected error for target without any rule")
+	}
+
+	// Canned recipes expand to one command per line
+	parser = NewParser()
+	if _, err := parser.ParseFile(filepath.Join("testdata", "define.mk")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	commands, err := parser.ExpandRecipe("release")
+	if err != nil {
+		t.Fatalf("Failed to expand recipe: %v", err)
+	}
+	expected := []string{`@echo "releasing 1.2.3"`, "git tag v1.2.3 \\\n\t\t-m \"release\""}
+	if len(commands) != 2 || commands[0] != expected[0] || commands[1] != expected[1] {
+		t.Errorf("Expected %q, got %q", expected, commands)
+	}
+}
+
+func TestTargetSpecificVariables(t *testing.T) {
+	parser := NewParser()
+	mf, err := parser.ParseFile(filepath.Join("testdata", "target_vars.mk"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	// Assignments don't produce fake targets
+	debug, ok := mf.Targets["debug"]
+	if !ok {
+		t.Fatal("Target 'debug' not found")
+	}
+	if len(debug.Dependencies) != 1 || debug.Dependencies[0] != "app" {
+		t.Errorf("Expected 'debug' to depend on app only, got %v", debug.Dependencies)
+	}
+	if _, ok := mf.Targets["main.o"]; ok {
+		t.Error("Target-specific assignment should not define a rule for 'main.o'")
+	}
+	if len(mf.TargetVariables["debug"]) != 3 || len(mf.PatternVariables) != 2 {
+		t.Fatalf("Expected 3 target and 2 pattern assignments, got %d and %d", len(mf.TargetVariables["debug"]), len(mf.PatternVariables))
+	}
+	if verbose := mf.TargetVariables["debug"][2]; !verbose.IsExported || verbose.Target != "debug" {
+		t.Errorf("Expected exported VERBOSE for debug, got %+v", verbose)
+	}
+
+	tests := []struct {
+		variable string
+		target   string
+		expected string
+	}{
+		{"CFLAGS", "", "-O2"},
+		{"CFLAGS", "debug", "-O2 -g"},
+		{"MODE", "debug", "debug"},
+		{"CFLAGS", "util.o", "-O2 -fPIC"},
+		{"CFLAGS", "lib/util.o", "-O2 -fPIC -Ilib"},
+		{"CFLAGS", "main.o", "-O2 -fPIC -DMAIN"},
+		{"TOKEN", "test", "abc"},
+		{"SECRET", "", "hidden"},
+	}
+	for _, tt := range tests {
+		expanded, err := parser.ExpandTargetVariable(tt.variable, tt.target)
+		if err != nil {
+			t.Errorf("%s in %q: failed to expand: %v", tt.variable, tt.target, err)
+			continue
+		}
+		if expanded != tt.expected {
+			t.Errorf("%s in %q: expected %q, got %q", tt.variable, tt.target, tt.expected, expanded)
+		}
+	}
+
+	// Private globals are invisible inside recipes
+	if _, err := parser.ExpandTargetVariable("SECRET", "app"); err == nil {
+		t.Error("Expected private SECRET to be undefined in the recipe of 'app'")
+	}
+
+	commands, err := parser.ExpandRecipe("debug")
+	if err != nil || len(commands) != 1 || commands[0] != "@echo debug build with -O2 -g" {
+		t.Errorf("Unexpected recipe for 'debug': %q (%v)", commands, err)
+	}
+}
+
+func TestTargetVariableInlineRecipe(t *testing.T) {
+	// A ';' before '=' starts a recipe; after it, it belongs to the value
+	mf, err := NewParser().parse(strings.NewReader("all: ;x=1\ndebug: FLAGS = a;b\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	all, ok := mf.Targets["all"]
+	if !ok || strings.Join(all.Commands, "|") != "x=1" || len(all.Dependencies) != 0 {
+		t.Errorf("Expected 'all' with the recipe 'x=1', got %+v", all)
+	}
+	if vars := mf.TargetVariables["all"]; len(vars) != 0 {
+		t.Errorf("Expected no target-specific variables for 'all', got %+v", vars)
+	}
+	if vars := mf.TargetVariables["debug"]; len(vars) != 1 || vars[0].Name != "FLAGS" || vars[0].Value != "a;b" {
+		t.Errorf("Expected FLAGS = 'a;b' for 'debug', got %+v", vars)
+	}
+}
+
+func TestStaticPatternMismatch(t *testing.T) {
+	mf, err := NewParser().parse(strings.NewReader("x main.o: %.o: %.c | dir\n\tcc -c $<\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(mf.Diagnostics) != 1 || mf.Diagnostics[0].Code != "pattern-mismatch" || !strings.Contains(mf.Diagnostics[0].Message, "'x'") {
+		t.Errorf("Expected a pattern-mismatch error for 'x', got %v", mf.Diagnostics)
+	}
+
+	// The target keeps its recipe but none of the rule's prerequisites
+	x := mf.Targets["x"]
+	if x == nil || len(x.Dependencies) != 0 || len(x.OrderOnly) != 0 || len(x.Commands) != 1 {
+		t.Errorf("Expected 'x' with a recipe and no prerequisites, got %+v", x)
+	}
+	main := mf.Targets["main.o"]
+	if main == nil || strings.Join(main.Dependencies, " ") != "main.c" || strings.Join(main.OrderOnly, " ") != "dir" {
+		t.Errorf("Expected 'main.o' to depend on main.c | dir, got %+v", main)
+	}
+}
+
+func TestParseRuleKinds(t *testing.T) {
+	parser := NewParser()
+	mf, err := parser.ParseFile(filepath.Join("testdata", "rules.mk"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	// Order-only prerequisites are kept apart from normal ones
+	build := mf.Targets["build"]
+	if strings.Join(build.Dependencies, " ") != "main.o util.o" {
+		t.Errorf("Expected build dependencies 'main.o util.o', got %v", build.Dependencies)
+	}
+	if strings.Join(build.OrderOnly, " ") != "out logs" {
+		t.Errorf("Expected build order-only dependencies 'out logs', got %v", build.OrderOnly)
+	}
+	commands, err := parser.ExpandRecipe("build")
+	if err != nil || len(commands) != 1 || commands[0] != "cc -o build main.o util.o # out logs" {
+		t.Errorf("Unexpected recipe for 'build': %q (%v)", commands, err)
+	}
+
+	// Each double-colon rule is kept with its own prerequisites and recipe
+	clean := mf.Targets["clean"]
+	if !clean.DoubleColon || len(clean.Rules) != 2 {
+		t.Fatalf("Expected double-colon 'clean' with 2 rules, got %+v", clean)
+	}
+	if clean.Rules[0].Description != "Remove objects" || len(clean.Rules[0].Dependencies) != 0 {
+		t.Errorf("Unexpected first rule of 'clean': %+v", clean.Rules[0])
+	}
+	if strings.Join(clean.Rules[1].Dependencies, " ") != "out" || clean.Rules[1].LineNumber != 15 {
+		t.Errorf("Unexpected second rule of 'clean': %+v", clean.Rules[1])
+	}
+	if strings.Join(clean.Dependencies, " ") != "out" {
+		t.Errorf("Expected clean dependencies 'out', got %v", clean.Dependencies)
+	}
+	commands, err = parser.ExpandRecipe("clean")
+	if err != nil || strings.Join(commands, "; ") != "rm -f *.o; rm -rf out" {
+		t.Errorf("Unexpected recipe for 'clean': %q (%v)", commands, err)
+	}
+
+	// Static pattern rules substitute the stem in order-only prerequisites
+	if main := mf.Targets["main.o"]; strings.Join(main.OrderOnly, " ") != "main.d" {
+		t.Errorf("Expected main.o order-only dependency 'main.d', got %v", main.OrderOnly)
+	}
+
+	// Grouped targets share one rule
+	for _, name := range []string{"parser.c", "parser.h"} {
+		target, ok := mf.Targets[name]
+		if !ok {
+			t.Fatalf("Expected grouped target '%s'", name)
+		}
+		if strings.Join(target.Group, " ") != "parser.c parser.h" || strings.Join(target.Dependencies, " ") != "parser.y" {
+			t.Errorf("Unexpected grouped target '%s': %+v", name, target)
+		}
+	}
+	if _, ok := mf.Targets["parser.h &"]; ok {
+		t.Error("Expected '&' to be stripped from grouped targets")
+	}
+
+	if len(mf.PatternRules) != 1 || mf.PatternRules[0].String() != "%.pb.c: %.proto | gen" {
+		t.Errorf("Unexpected pattern rules: %v", mf.PatternRules)
+	}
+
+	graph := parser.BuildDependencyGraph()
+	if logs := graph.Nodes["logs"]; logs == nil || !slices.Contains(logs.Dependents, "build") {
+		t.Errorf("Expected 'build' among the dependents of 'logs', got %+v", logs)
+	}
+	deps, err := parser.GetTargetDependencies("build", 10)
+	if err != nil || !slices.Contains(deps, "out") {
+		t.Errorf("Expected order-only 'out' in the dependencies of 'build', got %v (%v)", deps, err)
+	}
+}
+
+func TestMergeRules(t *testing.T) {
+	parser := NewParser()
+	path := filepath.Join("testdata", "merge.mk")
+	mf, err := parser.ParseFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	// Prerequisites of every rule are merged, the recipe's rule first
+	build := mf.Targets["build"]
+	if strings.Join(build.Dependencies, " ") != "main.o util.o lib.a" {
+		t.Errorf("Expected build dependencies 'main.o util.o lib.a', got %v", build.Dependencies)
+	}
+	if build.Description != "Build everything" || build.LineNumber != 2 || !build.IsPhony {
+		t.Errorf("Unexpected build target: %+v", build)
+	}
+	if len(build.Rules) != 2 || build.Rules[0].LineNumber != 2 || build.Rules[1].LineNumber != 7 {
+		t.Errorf("Expected build rules at lines 2 and 7, got %+v", build.Rules)
+	}
+	commands, err := parser.ExpandRecipe("build")
+	if err != nil || len(commands) != 1 || commands[0] != "cc -o app main.o util.o lib.a" {
+		t.Errorf("Unexpected recipe for 'build': %q (%v)", commands, err)
+	}
+
+	// A second recipe replaces the first, with make's warnings
+	version := mf.Targets["version"]
+	if len(version.Commands) != 1 || version.Commands[0] != "@echo 2.0" {
+		t.Errorf("Expected the last recipe for 'version', got %q", version.Commands)
+	}
+	if !version.Rules[0].Overridden || version.Rules[1].Overridden {
+		t.Errorf("Expected only the first recipe of 'version' to be overridden")
+	}
+
+	expected := []string{
+		path + ":14: warning: overriding recipe for target 'version'",
+		path + ":11: warning: ignoring old recipe for target 'version'",
+		path + ":21: *** target file 'both' has both : and :: entries",
+	}
+	if len(mf.Diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(mf.Diagnostics), mf.Diagnostics)
+	}
+	for i, d := range mf.Diagnostics {
+		if d.String() != expected[i] {
+			t.Errorf("Diagnostic %d: expected %q, got %q", i, expected[i], d.String())
+		}
+	}
+	if both := mf.Targets["both"]; both.DoubleColon || strings.Join(both.Dependencies, " ") != "a" {
+		t.Errorf("Expected the '::' rule for 'both' to be dropped, got %+v", both)
+	}
+}
+
+func TestParseSyntaxRoundTrip(t *testing.T) {
+	sources := map[string]string{
+		"crlf":                "all: a \\\r\n  b\r\n\techo $@\r\n",
+		"no final newline":    "X = 1",
+		"trailing backslash":  "X = a \\",
+		"unterminated define": "define X\n  body\n",
+		"empty":               "",
+		"blank lines":         "\n\n \t\n",
+	}
+	err := filepath.Walk("testdata", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if filepath.Ext(path) == ".mk" || info.Name() == "Makefile" {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			sources[path] = string(src)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read testdata: %v", err)
+	}
+
+	for name, src := range sources {
+		if got := ParseSyntax([]byte(src)).String(); got != src {
+			t.Errorf("%s: round trip mismatch:\nexpected %q\ngot      %q", name, src, got)
+		}
+	}
+}
+
+func TestParseSyntax(t *testing.T) {
+	src := "# Build\n" +
+		"CC ?= gcc # compiler\n" +
+		"build: main.o \\\n" +
+		"  util.o | out ; echo hi\n" +
+		"\n" +
+		"\t@echo $@\n" +
+		"ifeq ($(CC), gcc)\n" +
+		"debug: CFLAGS += -g\n" +
+		"endif\n" +
+		"define BODY =\n" +
+		"  a\n" +
+		"endef\n" +
+		"$(OBJS): %.o: %.c\n" +
+		"-include x.mk\n"
+	tree := ParseSyntax([]byte(src))
+
+	kinds := []string{}
+	for _, n := range tree.Nodes {
+		kinds = append(kinds, n.Kind.String())
+	}
+	expected := "comment assignment rule blank recipe directive assignment directive define rule directive"
+	if strings.Join(kinds, " ") != expected {
+		t.Errorf("Expected statements %q, got %q", expected, strings.Join(kinds, " "))
+	}
+
+	// Tokens carry their own ranges, across continuation lines too
+	tests := []struct {
+		line, column int
+		kind         NodeKind
+		text         string
+		end          Position
+	}{
+		{2, 1, NameNode, "CC", Position{Offset: 10, Line: 2, Column: 3}},
+		{2, 12, CommentNode, "# compiler", Position{Offset: 28, Line: 2, Column: 21}},
+		{3, 1, TargetNode, "build", Position{Offset: 34, Line: 3, Column: 6}},
+		{4, 4, PrerequisiteNode, "util.o", Position{Offset: 53, Line: 4, Column: 9}},
+		{4, 12, OrderOnlyNode, "out", Position{Offset: 59, Line: 4, Column: 15}},
+		{4, 20, RecipeNode, "echo hi", Position{Offset: 69, Line: 4, Column: 25}},
+		{6, 3, RecipeNode, "\t@echo $@", Position{Offset: 80, Line: 6, Column: 10}},
+		{7, 8, ArgumentNode, "($(CC), gcc)", Position{Offset: 98, Line: 7, Column: 18}},
+		{8, 3, TargetNode, "debug", Position{Offset: 104, Line: 8, Column: 6}},
+		{11, 2, TextNode, "  a", Position{Offset: 142, Line: 11, Column: 4}},
+		{12, 1, KeywordNode, "endef", Position{Offset: 148, Line: 12, Column: 6}},
+		{13, 11, TargetPatternNode, "%.o", Position{Offset: 161, Line: 13, Column: 13}},
+		{14, 10, ArgumentNode, "x.mk", Position{Offset: 180, Line: 14, Column: 14}},
+	}
+	for _, tt := range tests {
+		n := tree.NodeAt(tt.line, tt.column)
+		if n == nil {
+			t.Errorf("%d:%d: expected a node", tt.line, tt.column)
+			continue
+		}
+		if n.Kind != tt.kind || n.Text != tt.text || n.Range.End != tt.end {
+			t.Errorf("%d:%d: expected %s %q ending at %+v, got %s %q ending at %+v",
+				tt.line, tt.column, tt.kind, tt.text, tt.end, n.Kind, n.Text, n.Range.End)
+		}
+	}
+
+	rule := tree.Nodes[2]
+	if rule.Range.Start.Line != 3 || rule.Range.End.Line != 4 || rule.EOL != "\n" {
+		t.Errorf("Expected the rule to span lines 3-4, got %+v", rule.Range)
+	}
+	if n := tree.NodeAt(20, 1); n != nil {
+		t.Errorf("Expected no node past the end, got %s", n.Kind)
+	}
+}
+
+func TestSyntaxTreeStatement(t *testing.T) {
+	src := "build: main.o \\\n" +
+		"  util.o\n" +
+		"\tcc -c main.c\n" +
+		"\n" +
+		"# link\n" +
+		"\tcc -o $@ $^\n" +
+		"\n" +
+		"X = 1\n" +
+		"define BODY\n" +
+		"  a\n" +
+		"endef\n"
+	tree := ParseSyntax([]byte(src))
+
+	tests := []struct {
+		line     int
+		expected string
+		found    bool
+	}{
+		{1, "build: main.o \\\n  util.o\n\tcc -c main.c\n\n# link\n\tcc -o $@ $^", true},
+		{2, "", false},
+		{7, "", false},
+		{8, "X = 1", true},
+		{9, "define BODY\n  a\nendef", true},
+	}
+	for _, tt := range tests {
+		text, found := tree.Statement(tt.line)
+		if text != tt.expected || found != tt.found {
+			t.Errorf("Line %d: expected %q (%t), got %q (%t)", tt.line, tt.expected, tt.found, text, found)
+		}
+	}
+}
+
+func TestIsSpecialTarget(t *testing.T) {
+	tests := map[string]bool{
+		".PHONY":  true,
+		".WAIT":   true,
+		".c.o":    true,
+		".c":      true,
+		".cc.out": true,
+		".venv":   false,
+		".x.y":    false,
+		"all":     false,
+	}
+	for name, expected := range tests {
+		if got := IsSpecialTarget(name); got != expected {
+			t.Errorf("%s: expected %t, got %t", name, expected, got)
+		}
+	}
+}
+
+func TestFindCycles(t *testing.T) {
+	parser := NewParser()
+	path := filepath.Join("testdata", "cycle.mk")
+	if _, err := parser.ParseFile(path); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	cycles := parser.FindCycles()
+	if len(cycles) != 2 {
+		t.Fatalf("Expected 2 cycles, got %d: %+v", len(cycles), cycles)
+	}
+	if strings.Join(cycles[0].Targets, " ") != "a b c" || strings.Join(cycles[1].Targets, " ") != "d" {
+		t.Errorf("Expected cycles [a b c] and [d], got %v and %v", cycles[0].Targets, cycles[1].Targets)
+	}
+
+	// Each edge points at the rule that declared it
+	edges := []string{}
+	for _, e := range cycles[0].Edges {
+		edges = append(edges, fmt.Sprintf("%s->%s:%d:%t", e.From, e.To, e.LineNumber, e.OrderOnly))
+	}
+	if strings.Join(edges, " ") != "a->b:4:false b->c:7:false b->a:7:true c->a:10:false" {
+		t.Errorf("Unexpected cycle edges: %v", edges)
+	}
+
+	// The same edges make drops while updating the targets
+	expected := []string{
+		"Circular c <- a dependency dropped.",
+		"Circular b <- a dependency dropped.",
+		"Circular d <- d dependency dropped.",
+	}
+	messages := append(cycles[0].Messages(), cycles[1].Messages()...)
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected messages %q, got %q", expected, messages)
+	}
+
+	// Dependencies of a cyclic target are still collected once
+	deps, err := parser.GetTargetDependencies("all", 10)
+	if err != nil || strings.Join(deps, " ") != "a b c e f" {
+		t.Errorf("Expected dependencies 'a b c e f', got %v (%v)", deps, err)
+	}
+}
+
+func TestPlanBuild(t *testing.T) {
+	parser := NewParser()
+	if _, err := parser.ParseFile(filepath.Join("testdata", "plan", "Makefile")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if goal := parser.DefaultGoal(); goal != "all" {
+		t.Errorf("Expected default goal 'all', got %q", goal)
+	}
+
+	// Prerequisites are visited depth first, left to right, order-only last
+	plan, err := parser.PlanBuild(nil)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	steps := []string{}
+	for _, step := range plan.Steps {
+		steps = append(steps, step.Target)
+	}
+	if strings.Join(steps, " ") != "main.o util.o link.ld app gen docs out all" {
+		t.Errorf("Unexpected step order: %v", steps)
+	}
+	if util := plan.Steps[1]; util.Implicit == nil || strings.Join(util.Prerequisites, " ") != "util.c util.h" || util.Commands[0] != "cc -c $<" {
+		t.Errorf("Expected util.o to be made by the pattern rule, got %+v", util)
+	}
+	if all := plan.Steps[7]; strings.Join(all.OrderOnly, " ") != "out" {
+		t.Errorf("Expected 'out' to be order-only for 'all', got %+v", all)
+	}
+	if strings.Join(plan.Sources, " ") != "main.c util.c" || strings.Join(plan.Missing, " ") != "util.h" {
+		t.Errorf("Unexpected sources %v and missing files %v", plan.Sources, plan.Missing)
+	}
+
+	// link.ld follows a .WAIT, so it waits for the object files
+	layers := []string{}
+	for _, layer := range plan.Layers {
+		layers = append(layers, strings.Join(layer, ","))
+	}
+	if strings.Join(layers, " ") != "main.o,util.o,gen,out link.ld,docs app all" {
+		t.Errorf("Unexpected layers: %v", layers)
+	}
+
+	// Prerequisites of a .NOTPARALLEL target run one at a time
+	plan, err = parser.PlanBuild([]string{"serial"})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Layers) != 4 || plan.Steps[2].Target != "three" || plan.Steps[2].Layer != 2 {
+		t.Errorf("Expected serialized prerequisites, got layers %v", plan.Layers)
+	}
+
+	if _, err := parser.PlanBuild([]string{"nonexistent"}); err == nil {
+		t.Error("Expected an error for a goal without a rule")
+	}
+}
+
+func TestPlanBuildCycle(t *testing.T) {
+	parser := NewParser()
+	if _, err := parser.ParseFile(filepath.Join("testdata", "cycle.mk")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	plan, err := parser.PlanBuild([]string{"all", "d"})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	steps := []string{}
+	for _, step := range plan.Steps {
+		steps = append(steps, step.Target)
+	}
+	if strings.Join(steps, " ") != "c b a f e all d" {
+		t.Errorf("Unexpected step order: %v", steps)
+	}
+	dropped := []string{}
+	for _, e := range plan.Dropped {
+		dropped = append(dropped, e.From+"<-"+e.To)
+	}
+	if strings.Join(dropped, " ") != "c<-a b<-a d<-d" {
+		t.Errorf("Expected the circular dependencies make drops, got %v", dropped)
+	}
+}
+
+func TestCheckStale(t *testing.T) {
+	dir := t.TempDir()
+	src := "app: main.o util.o\n" +
+		"\tcc -o $@ $^\n" +
+		"%.o: %.c\n" +
+		"\tcc -c $<\n" +
+		"util.o: util.h\n" +
+		"check: app\n" +
+		"\t./app\n" +
+		"docs: | out\n" +
+		"\ttouch $@\n" +
+		"out:\n" +
+		"\tmkdir $@\n" +
+		"broken: missing.h\n" +
+		"\ttouch $@\n" +
+		".PHONY: check\n"
+	now := time.Now()
+	files := []struct {
+		name string
+		age  time.Duration
+	}{
+		{"Makefile", 4 * time.Hour},
+		{"main.c", 3 * time.Hour},
+		{"util.c", 3 * time.Hour},
+		{"main.o", 2 * time.Hour},
+		{"util.o", 2 * time.Hour},
+		{"app", time.Hour},
+		{"docs", time.Hour},
+		{"util.h", 0},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		content := ""
+		if f.name == "Makefile" {
+			content = src
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", f.name, err)
+		}
+		mtime := now.Add(-f.age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set the time of %s: %v", f.name, err)
+		}
+	}
+
+	parser := NewParser()
+	if _, err := parser.ParseFile(filepath.Join(dir, "Makefile")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	staleness, _, err := parser.CheckStale([]string{"check", "docs", "broken"})
+	if err != nil {
+		t.Fatalf("Failed to check: %v", err)
+	}
+
+	expected := []struct {
+		target  string
+		rebuild bool
+		reasons string
+		err     string
+	}{
+		{"main.o", false, "", ""},
+		{"util.o", true, "util.o older than util.h", ""},
+		{"app", true, "util.o will be rebuilt", ""},
+		{"check", true, "check is phony; app will be rebuilt", ""},
+		{"out", true, "out does not exist", ""},
+		{"docs", false, "", ""},
+		{"broken", true, "broken does not exist", "No rule to make target 'missing.h', needed by 'broken'"},
+	}
+	if len(staleness) != len(expected) {
+		t.Fatalf("Expected %d targets, got %d", len(expected), len(staleness))
+	}
+	for i, want := range expected {
+		s := staleness[i]
+		if s.Target != want.target || s.Rebuild != want.rebuild || strings.Join(s.Reasons, "; ") != want.reasons || s.Error != want.err {
+			t.Errorf("Target %d: expected %+v, got %+v", i, want, s)
+		}
+	}
+	if !staleness[0].Exists || staleness[4].Exists {
+		t.Errorf("Expected main.o to exist and out not to")
+	}
+}
+
+func TestAffectedTargets(t *testing.T) {
+	parser := NewParser()
+	path := filepath.Join("testdata", "plan", "Makefile")
+	if _, err := parser.ParseFile(path); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	abs, err := filepath.Abs(filepath.Join("testdata", "plan", "main.c"))
+	if err != nil {
+		t.Fatalf("Failed to get absolute path: %v", err)
+	}
+	report := parser.AffectedTargets([]string{"./util.h", abs, "gen", "out", "README.md", "Makefile"})
+
+	// main.o and util.o are made by a pattern rule; out is only order-only
+	affected := []string{}
+	for _, impact := range report.Targets {
+		affected = append(affected, impact.Target+"("+strings.Join(impact.Changed, ",")+")")
+	}
+	if strings.Join(affected, " ") != "all(util.h,main.c,gen) app(util.h,main.c) util.o(util.h) docs(gen) main.o(main.c)" {
+		t.Errorf("Unexpected affected targets: %v", affected)
+	}
+	if !report.Targets[0].Phony || report.Targets[1].Phony {
+		t.Errorf("Expected only 'all' to be phony")
+	}
+	if strings.Join(report.Unused, " ") != "out README.md Makefile" {
+		t.Errorf("Unexpected unused files: %v", report.Unused)
+	}
+	if strings.Join(report.Makefiles, " ") != "Makefile" {
+		t.Errorf("Expected the Makefile to be reported, got %v", report.Makefiles)
+	}
+}
+
+func TestParseDependencyFiles(t *testing.T) {
+	parser := NewParser()
+	dir := filepath.Join("testdata", "depfiles")
+	mf, err := parser.ParseFile(filepath.Join(dir, "Makefile"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if len(mf.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", mf.Diagnostics)
+	}
+
+	// Escaped spaces and continuation lines are handled
+	main := mf.Targets["main.o"]
+	if main == nil || strings.Join(main.Dependencies, ",") != "main.c,util.h,my config.h,gen/version.h" {
+		t.Fatalf("Unexpected prerequisites for main.o: %+v", main)
+	}
+	if main.File != filepath.Join(dir, "main.d") || main.LineNumber != 1 || !main.Rules[0].Generated {
+		t.Errorf("Expected main.o to come from main.d:1, got %s:%d", main.File, main.LineNumber)
+	}
+
+	// Header rules from -MP have neither prerequisites nor a recipe
+	header := mf.Targets["my config.h"]
+	if header == nil || len(header.Dependencies) != 0 || len(header.Commands) != 0 {
+		t.Errorf("Expected an empty rule for 'my config.h', got %+v", header)
+	}
+
+	// Generated prerequisites are a distinct kind of edge
+	graph := parser.BuildDependencyGraph()
+	util := graph.Nodes["util.o"]
+	if strings.Join(util.Dependencies, ",") != "util.c" || strings.Join(util.Generated, ",") != "util.h" {
+		t.Errorf("Expected util.c to be explicit and util.h generated, got %v and %v", util.Dependencies, util.Generated)
+	}
+	dependents := append([]string{}, graph.Nodes["util.h"].Dependents...)
+	sort.Strings(dependents)
+	if strings.Join(dependents, ",") != "main.o,util.o" {
+		t.Errorf("Expected util.h to be a prerequisite of both objects, got %v", dependents)
+	}
+	for _, e := range parser.Edges("util.o") {
+		if e.Generated != (e.To == "util.h") {
+			t.Errorf("Unexpected edge kind for %s -> %s", e.From, e.To)
+		}
+	}
+
+	// Objects are still built by the pattern rule
+	plan, err := parser.PlanBuild([]string{"app"})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	for _, step := range plan.Steps {
+		if strings.HasSuffix(step.Target, ".o") && (step.Implicit == nil || step.Implicit.Dependencies[0] != strings.TrimSuffix(step.Target, ".o")+".c") {
+			t.Errorf("Expected %s to be made by the pattern rule, got %+v", step.Target, step)
+		}
+	}
+}
+
+func TestParseDependencyFileFragment(t *testing.T) {
+	// A Makefile fragment named *.d is not a compiler-generated file
+	parser := NewParser()
+	mf, err := parser.ParseFile(filepath.Join("testdata", "depfiles", "fragment", "Makefile"))
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if len(mf.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", mf.Diagnostics)
+	}
+	if flags, ok := mf.Variables["FLAGS"]; !ok || flags.Value != "-O2" {
+		t.Errorf("Expected FLAGS from config.d to be '-O2', got %+v", flags)
+	}
+	main := mf.Targets["main.o"]
+	if main == nil || len(main.Commands) != 1 || main.Rules[0].Generated {
+		t.Errorf("Expected main.o to have the recipe from config.d, got %+v", main)
+	}
+
+	tests := []struct {
+		src       string
+		generated bool
+	}{
+		{"main.o: main.c util.h \\\n gen/version.h\nutil.h:\n", true},
+		{"# generated\nmy\\ config.h:\n\n", true},
+		{"FLAGS := -O2\n", false},
+		{"main.o: main.c\n\tcc -c main.c\n", false},
+		{"include other.d\n", false},
+		{"main.o: $(SRCS)\n", false},
+		{"main.o: main.c ; cc -c main.c\n", false},
+	}
+	for _, tt := range tests {
+		if got := isGeneratedDependencies(tt.src); got != tt.generated {
+			t.Errorf("%q: expected %t, got %t", tt.src, tt.generated, got)
+		}
+	}
+}
+
+func TestDependencyWords(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"main.o: main.c util.h", "main.o|:|main.c|util.h"},
+		{`a\ b.o: c\#d.h cost$$.h`, "a b.o|:|c#d.h|cost$.h"},
+		{`C:\src\main.o: C:\src\main.c`, `C:\src\main.o|:|C:\src\main.c`},
+		{"util.h:", "util.h|:"},
+		{"# comment", ""},
+	}
+	for _, tt := range tests {
+		if words := strings.Join(dependencyWords(tt.line), "|"); words != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.line, tt.expected, words)
+		}
+	}
+}
+
+func TestSubMakes(t *testing.T) {
+	parser := NewParser()
+	dir := filepath.Join("testdata", "submake")
+	if _, err := parser.ParseFile(filepath.Join(dir, "Makefile")); err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	subMakes := parser.SubMakes("build")
+	expected := []struct {
+		directory string
+		file      string
+		goals     string
+		makefile  string
+	}{
+		{filepath.Join("services", "api"), "", "build", filepath.Join(dir, "services", "api", "Makefile")},
+		{filepath.Join("services", "web"), "web.mk", "", filepath.Join(dir, "services", "web", "web.mk")},
+		{"", "", "lint", filepath.Join(dir, "Makefile")},
+	}
+	if len(subMakes) != len(expected) {
+		t.Fatalf("Expected %d sub-makes, got %d: %+v", len(expected), len(subMakes), subMakes)
+	}
+	for i, want := range expected {
+		s := subMakes[i]
+		if s.Directory != want.directory || s.File != want.file || strings.Join(s.Goals, " ") != want.goals || s.Makefile != want.makefile {
+			t.Errorf("Sub-make %d: expected %+v, got %+v", i, want, s)
+		}
+	}
+
+	// Targets of other Makefiles are qualified with their path
+	deps, met, err := parser.GetStitchedDependencies("all", 10)
+	if err != nil {
+		t.Fatalf("Failed to get dependencies: %v", err)
+	}
+	api := filepath.Join("services", "api", "Makefile") + ":"
+	web := filepath.Join("services", "web", "web.mk") + ":"
+	want := []string{"build", api + "build", api + "bin/api", api + "main.go", web + "dist", web + "assets", "lint"}
+	if strings.Join(deps, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected dependencies %v, got %v", want, deps)
+	}
+	if len(met) != 3 || met[2].Parser != parser {
+		t.Errorf("Expected the sub-make of this Makefile to reuse its parser, got %+v", met)
+	}
+}
+
+func TestSplitShellList(t *testing.T) {
+	segments := splitShellList(`cd a && $(MAKE) x || echo "a;b" | tee log; make y`)
+	expected := []string{"cd a ", " $(MAKE) x ", ` echo "a;b" `, " tee log", " make y"}
+	if strings.Join(segments, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, segments)
+	}
+}
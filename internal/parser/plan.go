@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PlanStep is a target make would consider while updating the goals
+type PlanStep struct {
+	Target        string
+	Prerequisites []string // Prerequisites updated first, without dropped circular ones
+	OrderOnly     []string
+	Phony         bool
+	Commands      []string       // Recipe run when the target is out of date
+	Implicit      *ImplicitMatch // Pattern rule providing the recipe, if any
+	Layer         int            // Steps of the same layer can run in parallel with -j
+	edges         []*DependencyEdge
+}
+
+// BuildPlan is the order in which make would update targets for a set of
+// goals, without running anything
+type BuildPlan struct {
+	Goals       []string
+	Steps       []*PlanStep       // In the order make finishes them, prerequisites first
+	Layers      [][]string        // Targets that can be updated in parallel, layer by layer
+	Sources     []string          // Prerequisites without a rule that exist
+	Missing     []string          // Prerequisites without a rule that don't exist
+	Dropped     []*DependencyEdge // Circular dependencies make drops
+	NotParallel bool              // .NOTPARALLEL without prerequisites serializes every step
+}
+
+// DefaultGoal returns the goal make updates when none is given: the value
+// of .DEFAULT_GOAL, or else the first target not starting with a period
+// unless it contains a slash
+func (p *Parser) DefaultGoal() string {
+	if _, ok := p.makefile.Variables[".DEFAULT_GOAL"]; ok {
+		if value, err := p.ExpandVariable(".DEFAULT_GOAL"); err == nil {
+			if fields := strings.Fields(value); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	for _, t := range p.OrderedTargets() {
+		if strings.HasPrefix(t.Name, ".") && !strings.Contains(t.Name, "/") {
+			continue
+		}
+		return t.Name
+	}
+	return ""
+}
+
+// PlanBuild returns the order make would visit targets in to update the
+// goals, or the default goal when none are given. Prerequisites are
+// visited left to right, depth first, normal ones before order-only ones,
+// and each target finishes after its prerequisites. Layers group the
+// steps that can run at the same time with -j, honoring .WAIT and
+// .NOTPARALLEL.
+func (p *Parser) PlanBuild(goals []string) (*BuildPlan, error) {
+	if len(goals) == 0 {
+		goal := p.DefaultGoal()
+		if goal == "" {
+			return nil, fmt.Errorf("no targets")
+		}
+		goals = []string{goal}
+	}
+
+	plan := &BuildPlan{
+		Goals:   goals,
+		Steps:   []*PlanStep{},
+		Layers:  [][]string{},
+		Sources: []string{},
+		Missing: []string{},
+		Dropped: []*DependencyEdge{},
+	}
+	steps := make(map[string]*PlanStep)
+	const (
+		unvisited = iota
+		updating
+		done
+	)
+	state := make(map[string]int)
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = updating
+		step := p.planStep(name)
+		if step == nil {
+			state[name] = done
+			if p.fileExists(name) {
+				plan.Sources = append(plan.Sources, name)
+			} else {
+				plan.Missing = append(plan.Missing, name)
+			}
+			return
+		}
+		var edges []*DependencyEdge
+		step.Prerequisites, step.OrderOnly = []string{}, []string{}
+		for _, e := range step.edges {
+			switch state[e.To] {
+			case updating:
+				plan.Dropped = append(plan.Dropped, e)
+				continue
+			case unvisited:
+				visit(e.To)
+			}
+			edges = append(edges, e)
+			if e.OrderOnly {
+				step.OrderOnly = append(step.OrderOnly, e.To)
+			} else {
+				step.Prerequisites = append(step.Prerequisites, e.To)
+			}
+		}
+		step.edges = edges
+		state[name] = done
+		steps[name] = step
+		plan.Steps = append(plan.Steps, step)
+	}
+	for _, goal := range goals {
+		if p.planStep(goal) == nil && !p.fileExists(goal) {
+			return nil, fmt.Errorf("no rule to make target '%s'", goal)
+		}
+		if state[goal] == unvisited {
+			visit(goal)
+		}
+	}
+
+	p.planLayers(plan, steps)
+	return plan, nil
+}
+
+// planStep returns the step updating name, with its prerequisite edges,
+// or nil if no rule makes it
+func (p *Parser) planStep(name string) *PlanStep {
+	target, ok := p.makefile.Targets[name]
+	if ok && (len(target.Commands) > 0 || target.IsPhony || target.DoubleColon) {
+		return &PlanStep{Target: name, Phony: target.IsPhony, Commands: target.Commands, edges: p.Edges(name)}
+	}
+
+	// make searches the pattern rules for targets without a recipe
+	match, found := p.FindImplicitRule(name)
+	if !found {
+		if ok {
+			return &PlanStep{Target: name, Commands: []string{}, edges: p.Edges(name)}
+		}
+		return nil
+	}
+	step := &PlanStep{Target: name, Commands: match.Rule.Commands, Implicit: match}
+	implicit := func(dep string, orderOnly bool) *DependencyEdge {
+		return &DependencyEdge{From: name, To: dep, OrderOnly: orderOnly, File: match.Rule.File, LineNumber: match.Rule.LineNumber}
+	}
+	explicit := p.Edges(name)
+	for _, dep := range match.Dependencies {
+		step.edges = append(step.edges, implicit(dep, false))
+	}
+	for _, e := range explicit {
+		if !e.OrderOnly && !slices.Contains(match.Dependencies, e.To) {
+			step.edges = append(step.edges, e)
+		}
+	}
+	for _, dep := range match.OrderOnly {
+		step.edges = append(step.edges, implicit(dep, true))
+	}
+	for _, e := range explicit {
+		if e.OrderOnly && !slices.Contains(match.OrderOnly, e.To) {
+			step.edges = append(step.edges, e)
+		}
+	}
+	return step
+}
+
+// planLayers assigns each step the earliest layer it can run in: after
+// its prerequisites, after the prerequisites preceding a .WAIT, and after
+// the preceding prerequisite of a target listed in .NOTPARALLEL
+func (p *Parser) planLayers(plan *BuildPlan, steps map[string]*PlanStep) {
+	notParallel, serial := p.makefile.Targets[".NOTPARALLEL"]
+	if serial && len(notParallel.Dependencies) == 0 {
+		plan.NotParallel = true
+		for i, step := range plan.Steps {
+			step.Layer = i
+			plan.Layers = append(plan.Layers, []string{step.Target})
+		}
+		return
+	}
+
+	// after[x] lists the steps that must finish before x starts
+	after := make(map[string][]string)
+	for _, step := range plan.Steps {
+		for _, e := range step.edges {
+			if _, ok := steps[e.To]; ok {
+				after[step.Target] = append(after[step.Target], e.To)
+			}
+		}
+	}
+	var reaches func(from, to string, seen map[string]bool) bool
+	reaches = func(from, to string, seen map[string]bool) bool {
+		if from == to {
+			return true
+		}
+		seen[from] = true
+		for _, next := range after[from] {
+			if !seen[next] && reaches(next, to, seen) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, step := range plan.Steps {
+		var barrier, group []string
+		for _, e := range step.edges {
+			if _, ok := steps[e.To]; !ok {
+				continue
+			}
+			if e.Wait || (serial && slices.Contains(notParallel.Dependencies, step.Target)) {
+				barrier, group = append(barrier, group...), nil
+			}
+			for _, before := range barrier {
+				// Ordering a prerequisite before one it depends on is impossible
+				if !reaches(before, e.To, map[string]bool{}) {
+					after[e.To] = appendUnique(after[e.To], before)
+				}
+			}
+			group = append(group, e.To)
+		}
+	}
+
+	layers := make(map[string]int)
+	var layer func(name string) int
+	layer = func(name string) int {
+		if l, ok := layers[name]; ok {
+			return l
+		}
+		l := 0
+		for _, before := range after[name] {
+			l = max(l, layer(before)+1)
+		}
+		layers[name] = l
+		return l
+	}
+	for _, step := range plan.Steps {
+		step.Layer = layer(step.Target)
+		for len(plan.Layers) <= step.Layer {
+			plan.Layers = append(plan.Layers, []string{})
+		}
+		plan.Layers[step.Layer] = append(plan.Layers[step.Layer], step.Target)
+	}
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandRecipe expands the recipe make would run for a target, one entry
+// per command line, with automatic variables such as $@ and $< set for
+// that target. Targets without a recipe use a matching implicit rule. The
+// rules of a double-colon target are expanded one after another, each
+// with its own prerequisites.
+func (p *Parser) ExpandRecipe(name string) ([]string, error) {
+	target, ok := p.makefile.Targets[name]
+	if ok && target.DoubleColon {
+		expanded := []string{}
+		for _, rule := range target.Rules {
+			commands, err := p.expandCommands(name, rule.Commands, rule.Dependencies, rule.OrderOnly, "")
+			expanded = append(expanded, commands...)
+			if err != nil {
+				return expanded, err
+			}
+		}
+		return expanded, nil
+	}
+
+	var commands, prereqs, orderOnly []string
+	stem := ""
+	if ok {
+		commands = target.Commands
+		prereqs = target.Dependencies
+		orderOnly = target.OrderOnly
+		stem = target.Stem
+	}
+	if len(commands) == 0 && (!ok || !target.IsPhony) {
+		if match, found := p.FindImplicitRule(name); found {
+			commands = match.Rule.Commands
+			// The implicit prerequisite comes first, so it becomes $<
+			prereqs = append(append([]string{}, match.Dependencies...), prereqs...)
+			orderOnly = append(append([]string{}, match.OrderOnly...), orderOnly...)
+			stem = match.Stem
+			ok = true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("target not found: %s", name)
+	}
+	return p.expandCommands(name, commands, prereqs, orderOnly, stem)
+}
+
+// expandCommands expands recipe lines with the automatic variables of
+// one rule
+func (p *Parser) expandCommands(name string, commands, prereqs, orderOnly []string, stem string) ([]string, error) {
+	ctx := newExpandContext(false)
+	ctx.target = name
+	ctx.locals = p.automaticVariables(name, prereqs, orderOnly, stem)
+
+	expanded := []string{}
+	for _, command := range commands {
+		// A variable holding several lines, like a canned recipe, yields
+		// several command lines
+		expanded = append(expanded, splitRecipeLines(p.expand(command, ctx))...)
+	}
+	if len(ctx.errors) > 0 {
+		return expanded, fmt.Errorf("%s", strings.Join(ctx.errors, "; "))
+	}
+	return expanded, nil
+}
+
+// automaticVariables returns $@, $<, $^, $+, $?, $*, $| and their D and F
+// variants for a target with the given prerequisites and stem
+func (p *Parser) automaticVariables(name string, prereqs, orderOnly []string, stem string) map[string]string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, prereq := range prereqs {
+		if !seen[prereq] {
+			seen[prereq] = true
+			unique = append(unique, prereq)
+		}
+	}
+
+	first := ""
+	if len(prereqs) > 0 {
+		first = prereqs[0]
+	}
+
+	vars := map[string]string{
+		"@": name,
+		"<": first,
+		"^": strings.Join(unique, " "),
+		"+": strings.Join(prereqs, " "),
+		"?": strings.Join(p.newerPrerequisites(name, unique), " "),
+		"*": stem,
+		"|": strings.Join(appendUnique(nil, orderOnly...), " "),
+	}
+	for _, v := range []string{"@", "<", "^", "+", "?", "*", "|"} {
+		var dirs, files []string
+		for _, word := range strings.Fields(vars[v]) {
+			dir, file := filepath.Split(word)
+			if dir == "" {
+				dir = "."
+			} else if dir != "/" {
+				dir = strings.TrimSuffix(dir, "/")
+			}
+			dirs = append(dirs, dir)
+			files = append(files, file)
+		}
+		vars[v+"D"] = strings.Join(dirs, " ")
+		vars[v+"F"] = strings.Join(files, " ")
+	}
+	return vars
+}
+
+// newerPrerequisites returns the prerequisites that are newer than the
+// target, or all of them when the target file doesn't exist
+func (p *Parser) newerPrerequisites(name string, prereqs []string) []string {
+	info, err := os.Stat(p.resolvePath(name))
+	if err != nil {
+		return prereqs
+	}
+	newer := []string{}
+	for _, prereq := range prereqs {
+		prereqInfo, err := os.Stat(p.resolvePath(prereq))
+		if err != nil || prereqInfo.ModTime().After(info.ModTime()) {
+			newer = append(newer, prereq)
+		}
+	}
+	return newer
+}
+
+// splitRecipeLines splits expanded recipe text into command lines.
+// Backslash-newline continues a command, as it does in the shell.
+func splitRecipeLines(text string) []string {
+	lines := []string{}
+	current := ""
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasSuffix(line, "\\") {
+			current += line + "\n"
+			continue
+		}
+		current += line
+		if current = strings.TrimLeft(current, " \t"); current != "" {
+			lines = append(lines, current)
+		}
+		current = ""
+	}
+	if current = strings.TrimLeft(current, " \t"); current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
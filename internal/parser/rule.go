@@ -0,0 +1,350 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+)
+
+// ruleContext tracks the rule that following recipe lines belong to
+type ruleContext struct {
+	targets   []*Target
+	entries   []*Rule // This rule's entry in each target, parallel to targets
+	pattern   *PatternRule
+	condition *ConditionalBranch
+	active    bool
+}
+
+// addCommand appends a recipe line to every target of the rule. When a
+// single-colon target already has a recipe from another rule, the new
+// recipe replaces it and make's warnings are reported.
+func (p *Parser) addCommand(r *ruleContext, command string) {
+	if r.pattern != nil {
+		r.pattern.Commands = append(r.pattern.Commands, command)
+		return
+	}
+	for i, t := range r.targets {
+		entry := r.entries[i]
+		if len(entry.Commands) == 0 && !t.DoubleColon {
+			for _, old := range t.Rules {
+				if old != entry && len(old.Commands) > 0 {
+					p.report(SeverityWarning, "overriding-recipe", entry.File, p.lineRange(entry.File, entry.LineNumber), "overriding recipe for target '%s'", t.Name)
+					p.report(SeverityWarning, "ignoring-recipe", old.File, p.lineRange(old.File, old.LineNumber), "ignoring old recipe for target '%s'", t.Name)
+					old.Overridden = true
+				}
+			}
+			t.Commands = []string{}
+		}
+		entry.Commands = append(entry.Commands, command)
+		t.Commands = append(t.Commands, command)
+		t.mergeRules()
+	}
+}
+
+// parseRule parses a rule line such as "build: main.o | $(OUTDIR)",
+// "clean::", "a b &: src", "%.o: %.c" or "$(OBJS): %.o: %.c". It returns
+// nil if the line is not a rule.
+func (p *Parser) parseRule(line string, lineNumber int, description string) *ruleContext {
+	targetText, prereqText, ok := splitUnquoted(line, ':')
+	if !ok || strings.HasPrefix(prereqText, "=") {
+		return nil
+	}
+	doubleColon := strings.HasPrefix(prereqText, ":")
+	if doubleColon {
+		prereqText = prereqText[1:]
+	}
+	targetText = strings.TrimSpace(targetText)
+	grouped := strings.HasSuffix(targetText, "&")
+	if grouped {
+		targetText = strings.TrimSuffix(targetText, "&")
+	}
+	prereqText, recipe, hasRecipe := splitUnquoted(prereqText, ';')
+
+	rule := &ruleContext{
+		condition: p.currentBranch(),
+		active:    p.active(),
+	}
+	targetNames := strings.Fields(p.expandText(targetText))
+
+	// targets: target-pattern: prereq-patterns
+	var static *PatternRule
+	if targetPattern, prereqPatterns, isStatic := splitUnquoted(prereqText, ':'); isStatic {
+		deps, orderOnly := p.splitPrerequisites(prereqPatterns)
+		static = &PatternRule{
+			Targets:      strings.Fields(p.expandText(targetPattern)),
+			Dependencies: deps,
+			OrderOnly:    orderOnly,
+			Commands:     []string{},
+			Description:  description,
+			File:         p.file,
+			LineNumber:   lineNumber,
+			Condition:    rule.condition,
+		}
+	}
+	deps, orderOnly := p.splitPrerequisites(prereqText)
+
+	if static == nil && len(targetNames) > 0 && strings.Contains(targetNames[0], "%") {
+		rule.pattern = &PatternRule{
+			Targets:      targetNames,
+			Dependencies: deps,
+			OrderOnly:    orderOnly,
+			Commands:     []string{},
+			Description:  description,
+			File:         p.file,
+			LineNumber:   lineNumber,
+			Condition:    rule.condition,
+		}
+		if rule.active {
+			p.makefile.PatternRules = append(p.makefile.PatternRules, rule.pattern)
+		}
+		if hasRecipe {
+			p.addCommand(rule, strings.TrimSpace(recipe))
+		}
+		return rule
+	}
+
+	for _, targetName := range targetNames {
+		targetDeps, targetOrderOnly, stem := deps, orderOnly, ""
+		if static != nil {
+			s, ok := "", false
+			if len(static.Targets) > 0 {
+				s, ok = matchPattern(static.Targets[0], targetName)
+			}
+			if ok {
+				stem = s
+				targetDeps = substitutePatterns(static.Dependencies, stem)
+				targetOrderOnly = substitutePatterns(static.OrderOnly, stem)
+			} else {
+				// make keeps the target but gives it none of the rule's prerequisites
+				if rule.active {
+					p.report(SeverityError, "pattern-mismatch", p.file, p.lineRange(p.file, lineNumber), "target '%s' doesn't match the target pattern", targetName)
+				}
+				targetDeps, targetOrderOnly = []string{}, []string{}
+			}
+		}
+
+		entry := &Rule{
+			Dependencies: targetDeps,
+			OrderOnly:    targetOrderOnly,
+			Commands:     []string{},
+			Description:  description,
+			File:         p.file,
+			LineNumber:   lineNumber,
+		}
+
+		// Further rules for a target add to it rather than replacing it
+		if existing, ok := p.makefile.Targets[targetName]; ok && rule.active {
+			if existing.DoubleColon != doubleColon {
+				p.report(SeverityError, "mixed-colons", p.file, p.lineRange(p.file, lineNumber), "target file '%s' has both : and :: entries", targetName)
+				continue
+			}
+			existing.Rules = append(existing.Rules, entry)
+			existing.mergeRules()
+			if existing.Description == "" {
+				existing.Description = description
+			}
+			if static != nil && existing.StaticPattern == nil {
+				existing.StaticPattern, existing.Stem = static, stem
+			}
+			if grouped {
+				existing.Group = targetNames
+			}
+			if rule.condition != nil {
+				rule.condition.Targets = append(rule.condition.Targets, existing)
+			}
+			rule.targets = append(rule.targets, existing)
+			rule.entries = append(rule.entries, entry)
+			continue
+		}
+
+		target := &Target{
+			Name:         targetName,
+			Dependencies: targetDeps,
+			OrderOnly:    targetOrderOnly,
+			Commands:     []string{},
+			IsPhony:      p.phony[targetName],
+			Description:  description,
+			File:         p.file,
+			LineNumber:   lineNumber,
+			Condition:    rule.condition,
+			Stem:         stem,
+			DoubleColon:  doubleColon,
+			Rules:        []*Rule{entry},
+		}
+		if static != nil {
+			target.StaticPattern = static
+		}
+		if grouped {
+			target.Group = targetNames
+		}
+		if target.Condition != nil {
+			target.Condition.Targets = append(target.Condition.Targets, target)
+		}
+		if rule.active {
+			p.makefile.Targets[targetName] = target
+		}
+		rule.targets = append(rule.targets, target)
+		rule.entries = append(rule.entries, entry)
+	}
+	if hasRecipe {
+		p.addCommand(rule, strings.TrimSpace(recipe))
+	}
+	return rule
+}
+
+// mergeRules recomputes the prerequisites of a target from all its rules.
+// As in make, the prerequisites of the rule with the recipe come first so
+// that $< names the right file.
+func (t *Target) mergeRules() {
+	rules := t.Rules
+	if !t.DoubleColon {
+		for i, rule := range rules {
+			if len(rule.Commands) > 0 && !rule.Overridden {
+				rules = append([]*Rule{rule}, append(append([]*Rule{}, rules[:i]...), rules[i+1:]...)...)
+				break
+			}
+		}
+	}
+	t.Dependencies, t.OrderOnly = []string{}, []string{}
+	for _, rule := range rules {
+		t.Dependencies = appendUnique(t.Dependencies, rule.Dependencies...)
+		t.OrderOnly = appendUnique(t.OrderOnly, rule.OrderOnly...)
+	}
+}
+
+// splitPrerequisites expands a prerequisite list and splits it into
+// normal and order-only prerequisites at the '|'
+func (p *Parser) splitPrerequisites(text string) ([]string, []string) {
+	normal, orderOnly, _ := splitUnquoted(text, '|')
+	return strings.Fields(p.expandText(normal)), strings.Fields(p.expandText(orderOnly))
+}
+
+// appendUnique appends the values not already in list
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// parseTargetVariable parses a target- or pattern-specific variable
+// assignment such as "debug: CFLAGS += -g". It reports whether the line
+// was one.
+func (p *Parser) parseTargetVariable(line string, lineNumber int) bool {
+	targetText, assignment, ok := splitUnquoted(line, ':')
+	if !ok || strings.HasPrefix(assignment, "=") {
+		return false
+	}
+	// A ';' before any '=' starts an inline recipe, as in "all: ;x=1"
+	if semicolon := indexUnquoted(assignment, ';'); semicolon >= 0 {
+		if equals := indexUnquoted(assignment, '='); equals < 0 || semicolon < equals {
+			return false
+		}
+	}
+	matches := variableRegex.FindStringSubmatch(strings.TrimSpace(assignment))
+	if matches == nil {
+		return false
+	}
+	if !p.active() {
+		return true
+	}
+
+	prefixes := strings.Fields(matches[1])
+	operator := matches[3]
+	value := stripComment(matches[4])
+	for _, target := range strings.Fields(p.expandText(targetText)) {
+		variable := &Variable{
+			Name:       strings.TrimSpace(p.expandText(matches[2])),
+			RawValue:   value,
+			Value:      value,
+			Type:       assignmentTypes[operator],
+			IsExported: slices.Contains(prefixes, "export"),
+			IsOverride: slices.Contains(prefixes, "override"),
+			IsPrivate:  slices.Contains(prefixes, "private"),
+			File:       p.file,
+			LineNumber: lineNumber,
+			Condition:  p.currentBranch(),
+			Target:     target,
+		}
+		// Only simple assignments are expanded now; the rest are resolved
+		// in the context of the target when its recipe runs
+		switch variable.Type {
+		case SimpleAssignment:
+			variable.Flavor = SimpleFlavor
+			variable.Value = p.expandText(value)
+		case ImmediateAssignment:
+			variable.immediate = true
+			variable.Value = escapeDollars(p.expandText(value))
+		case ShellAssignment:
+			variable.Value = p.shellValue(value)
+		}
+
+		if strings.Contains(target, "%") {
+			p.makefile.PatternVariables = append(p.makefile.PatternVariables, variable)
+		} else {
+			p.makefile.TargetVariables[target] = append(p.makefile.TargetVariables[target], variable)
+		}
+	}
+	return true
+}
+
+// splitUnquoted splits s at the first sep that is not inside a variable
+// reference such as $(VAR:a=b) or ${VAR}
+func splitUnquoted(s string, sep byte) (string, string, bool) {
+	if i := indexUnquoted(s, sep); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, "", false
+}
+
+// indexUnquoted returns the index of the first sep in s that is outside
+// any variable reference, or -1
+func indexUnquoted(s string, sep byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '$':
+			if i+1 < len(s) && (s[i+1] == '(' || s[i+1] == '{') {
+				depth++
+				i++
+			}
+		case '(', '{':
+			if depth > 0 {
+				depth++
+			}
+		case ')', '}':
+			if depth > 0 {
+				depth--
+			}
+		case sep:
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// matchPattern matches name against a pattern containing a single '%'
+// and returns the stem
+func matchPattern(pattern, name string) (string, bool) {
+	idx := strings.IndexByte(pattern, '%')
+	if idx < 0 {
+		return "", pattern == name
+	}
+	prefix, suffix := pattern[:idx], pattern[idx+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// substitutePatterns replaces the '%' in each pattern with stem
+func substitutePatterns(patterns []string, stem string) []string {
+	result := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		result = append(result, strings.Replace(pattern, "%", stem, 1))
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Staleness tells whether make would update a target and why
+type Staleness struct {
+	Target  string
+	Exists  bool
+	ModTime time.Time // Modification time of the target file, if it exists
+	Rebuild bool
+	Reasons []string // Why the target would be updated, e.g. "utils.o older than utils.h"
+	Error   string   // Why make would stop instead, e.g. a prerequisite without a rule
+}
+
+// CheckStale compares the modification times of the targets make would
+// visit for the goals with those of their prerequisites, relative to the
+// Makefile's directory. As in make, phony and missing targets are always
+// updated, so is everything that depends on them, and order-only
+// prerequisites only need to exist.
+func (p *Parser) CheckStale(goals []string) ([]*Staleness, *BuildPlan, error) {
+	plan, err := p.PlanBuild(goals)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := make(map[string]*Staleness)
+	staleness := []*Staleness{}
+	for _, step := range plan.Steps {
+		s := &Staleness{Target: step.Target, Reasons: []string{}}
+		s.ModTime, s.Exists = p.modTime(step.Target)
+		if step.Phony {
+			s.Rebuild = true
+			s.Reasons = append(s.Reasons, fmt.Sprintf("%s is phony", step.Target))
+		} else if !s.Exists {
+			s.Rebuild = true
+			s.Reasons = append(s.Reasons, fmt.Sprintf("%s does not exist", step.Target))
+		}
+
+		check := func(dep string, orderOnly bool) {
+			if slices.Contains(plan.Missing, dep) {
+				if s.Error == "" {
+					s.Error = fmt.Sprintf("No rule to make target '%s', needed by '%s'", dep, step.Target)
+				}
+				return
+			}
+			prereq, ok := results[dep]
+			if ok && prereq.Error != "" {
+				if s.Error == "" {
+					s.Error = fmt.Sprintf("%s cannot be made", dep)
+				}
+				return
+			}
+			if orderOnly {
+				return
+			}
+			if ok && prereq.Rebuild {
+				s.Rebuild = true
+				s.Reasons = append(s.Reasons, fmt.Sprintf("%s will be rebuilt", dep))
+				return
+			}
+			if mtime, exists := p.modTime(dep); s.Exists && exists && mtime.After(s.ModTime) {
+				s.Rebuild = true
+				s.Reasons = append(s.Reasons, fmt.Sprintf("%s older than %s", step.Target, dep))
+			}
+		}
+		for _, dep := range step.Prerequisites {
+			check(dep, false)
+		}
+		for _, dep := range step.OrderOnly {
+			check(dep, true)
+		}
+
+		results[step.Target] = s
+		staleness = append(staleness, s)
+	}
+	return staleness, plan, nil
+}
+
+// modTime returns the modification time of a file relative to the
+// Makefile's directory, and whether it exists
+func (p *Parser) modTime(name string) (time.Time, bool) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(p.makefile.Path), name)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
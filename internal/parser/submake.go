@@ -0,0 +1,283 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SubMake is a recursive make invocation in a recipe, such as
+// "$(MAKE) -C services/api build"
+type SubMake struct {
+	Target    string   // Target whose recipe runs the sub-make
+	Command   string   // Expanded recipe line
+	Directory string   // Directory the sub-make runs in, from cd and -C, relative to the Makefile's directory
+	File      string   // Makefile given with -f, relative to Directory
+	Goals     []string // Goals on the command line; the default goal when empty
+	Makefile  string   // Path of the sub-Makefile, empty if it can't be found
+	Parser    *Parser  // Parsed sub-Makefile, set by LoadSubMake
+	Error     string   // Why the sub-Makefile couldn't be read
+}
+
+// makeOptionsWithArgument are the options of make that take a separate
+// argument, besides -C and -f
+var makeOptionsWithArgument = map[string]bool{
+	"-I": true, "-o": true, "-W": true,
+	"--include-dir": true, "--old-file": true, "--assume-old": true,
+	"--what-if": true, "--new-file": true, "--assume-new": true,
+}
+
+// shellKeywords may precede a command in a shell list
+var shellKeywords = map[string]bool{
+	"do": true, "then": true, "else": true, "exec": true, "command": true,
+}
+
+// SubMakes returns the recursive make invocations in the expanded recipe
+// of a target. A "cd dir" earlier in the same recipe line applies to the
+// invocations after it. Without -C or -f the sub-make reads this Makefile.
+func (p *Parser) SubMakes(name string) []*SubMake {
+	commands, _ := p.ExpandRecipe(name)
+	subMakes := []*SubMake{}
+	for _, command := range commands {
+		command = strings.ReplaceAll(command, "\\\n", " ")
+		line := strings.TrimLeft(command, "@-+ \t")
+		dir := ""
+		for _, segment := range splitShellList(line) {
+			words := strings.Fields(segment)
+			for len(words) > 0 && (shellKeywords[words[0]] || isAssignment(words[0])) {
+				words = words[1:]
+			}
+			if len(words) == 0 {
+				continue
+			}
+			if words[0] == "cd" && len(words) > 1 {
+				dir = joinDirectory(dir, unquote(words[1]))
+				continue
+			}
+			if base := filepath.Base(words[0]); base != "make" && base != "gmake" {
+				continue
+			}
+			subMake := &SubMake{Target: name, Command: command, Directory: dir, Goals: []string{}}
+			subMake.parseArguments(words[1:])
+			subMake.Makefile = p.resolveSubMakefile(subMake)
+			subMakes = append(subMakes, subMake)
+		}
+	}
+	return subMakes
+}
+
+// parseArguments reads the directory, Makefile and goals of a make
+// command line, skipping other options and variable overrides
+func (s *SubMake) parseArguments(args []string) {
+	for i := 0; i < len(args); i++ {
+		arg := unquote(args[i])
+		next := func() string {
+			if i+1 < len(args) {
+				i++
+				return unquote(args[i])
+			}
+			return ""
+		}
+		switch {
+		case arg == "-C" || arg == "--directory":
+			s.Directory = joinDirectory(s.Directory, next())
+		case strings.HasPrefix(arg, "--directory="):
+			s.Directory = joinDirectory(s.Directory, strings.TrimPrefix(arg, "--directory="))
+		case strings.HasPrefix(arg, "-C"):
+			s.Directory = joinDirectory(s.Directory, arg[2:])
+		case arg == "-f" || arg == "--file" || arg == "--makefile":
+			s.File = next()
+		case strings.HasPrefix(arg, "--file=") || strings.HasPrefix(arg, "--makefile="):
+			s.File = arg[strings.IndexByte(arg, '=')+1:]
+		case strings.HasPrefix(arg, "-f"):
+			s.File = arg[2:]
+		case makeOptionsWithArgument[arg]:
+			next()
+		case (arg == "-j" || arg == "-l") && i+1 < len(args) && isNumber(args[i+1]):
+			next()
+		case strings.HasPrefix(arg, "-"), isAssignment(arg):
+		default:
+			s.Goals = append(s.Goals, arg)
+		}
+	}
+}
+
+// resolveSubMakefile finds the Makefile a sub-make reads: the -f file, or
+// else the first of GNUmakefile, makefile and Makefile in its directory
+func (p *Parser) resolveSubMakefile(s *SubMake) string {
+	if s.Directory == "" && s.File == "" {
+		return p.makefile.Path
+	}
+	dir := joinDirectory(filepath.Dir(p.makefile.Path), s.Directory)
+	candidates := []string{"GNUmakefile", "makefile", "Makefile"}
+	if s.File != "" {
+		candidates = []string{s.File}
+	}
+	for _, name := range candidates {
+		path := joinDirectory(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadSubMake parses the Makefile of a sub-make, with the same include
+// directories and shell setting. Each Makefile is parsed once per parser
+// tree, so sub-makes that read this Makefile get this parser.
+func (p *Parser) LoadSubMake(s *SubMake) {
+	if s.Makefile == "" {
+		s.Error = "no Makefile found"
+		return
+	}
+	if p.subParsers == nil {
+		p.subParsers = make(map[string]*Parser)
+	}
+	if abs, err := filepath.Abs(p.makefile.Path); err == nil {
+		p.subParsers[abs] = p
+	}
+	abs, err := filepath.Abs(s.Makefile)
+	if err != nil {
+		s.Error = err.Error()
+		return
+	}
+	if sub, ok := p.subParsers[abs]; ok {
+		s.Parser = sub
+		return
+	}
+
+	sub := NewParser()
+	sub.SetIncludeDirs(p.includeDirs)
+	sub.SetAllowShell(p.allowShell)
+	sub.subParsers = p.subParsers
+	if _, err := sub.ParseFile(s.Makefile); err != nil {
+		s.Error = err.Error()
+		return
+	}
+	p.subParsers[abs] = sub
+	s.Parser = sub
+}
+
+// GetStitchedDependencies is GetTargetDependencies across recursive make
+// invocations: the goals a recipe passes to a sub-make count as
+// dependencies of its target, followed by their own dependencies. Targets
+// of other Makefiles are named "<Makefile>:<target>", with the Makefile
+// relative to this one's directory. It also returns every sub-make met.
+func (p *Parser) GetStitchedDependencies(targetName string, maxDepth int) ([]string, []*SubMake, error) {
+	if _, ok := p.makefile.Targets[targetName]; !ok {
+		return nil, nil, fmt.Errorf("target not found: %s", targetName)
+	}
+
+	root := filepath.Dir(p.makefile.Path)
+	qualify := func(q *Parser, name string) string {
+		if q == p {
+			return name
+		}
+		rel, err := filepath.Rel(root, q.makefile.Path)
+		if err != nil {
+			rel = q.makefile.Path
+		}
+		return rel + ":" + name
+	}
+
+	deps := []string{}
+	subMakes := []*SubMake{}
+	visited := make(map[string]bool)
+	var collect func(q *Parser, name string, depth int)
+	collect = func(q *Parser, name string, depth int) {
+		key := qualify(q, name)
+		if depth > maxDepth || visited[key] {
+			return
+		}
+		visited[key] = true
+
+		add := func(q *Parser, dep string) {
+			if key := qualify(q, dep); !visited[key] {
+				deps = appendUnique(deps, key)
+				collect(q, dep, depth+1)
+			}
+		}
+		if t, ok := q.makefile.Targets[name]; ok {
+			for _, dep := range appendUnique(append([]string{}, t.Dependencies...), t.OrderOnly...) {
+				add(q, dep)
+			}
+		}
+		for _, s := range q.SubMakes(name) {
+			q.LoadSubMake(s)
+			subMakes = append(subMakes, s)
+			if s.Parser == nil {
+				continue
+			}
+			goals := s.Goals
+			if len(goals) == 0 {
+				if goal := s.Parser.DefaultGoal(); goal != "" {
+					goals = []string{goal}
+				}
+			}
+			for _, goal := range goals {
+				add(s.Parser, goal)
+			}
+		}
+	}
+	collect(p, targetName, 0)
+	return deps, subMakes, nil
+}
+
+// splitShellList splits a shell command line at ;, &&, || and |
+func splitShellList(line string) []string {
+	var segments []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';' || c == '|' || c == '&' || c == '\n':
+			segments = append(segments, line[start:i])
+			if i+1 < len(line) && (c == '|' || c == '&') && line[i+1] == c {
+				i++
+			}
+			start = i + 1
+		}
+	}
+	return append(segments, line[start:])
+}
+
+// joinDirectory resolves dir against base unless it is absolute
+func joinDirectory(base, dir string) string {
+	if filepath.IsAbs(dir) || base == "" {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(base, dir)
+}
+
+// unquote strips the shell quotes around a word
+func unquote(word string) string {
+	if len(word) >= 2 && (word[0] == '\'' || word[0] == '"') && word[len(word)-1] == word[0] {
+		return word[1 : len(word)-1]
+	}
+	return word
+}
+
+// isAssignment reports whether a word is a variable assignment such as
+// CFLAGS=-O2
+func isAssignment(word string) bool {
+	eq := strings.IndexByte(word, '=')
+	return eq > 0 && !strings.HasPrefix(word, "-") && !strings.ContainsAny(word[:eq], "/$")
+}
+
+// isNumber reports whether a word is a decimal number
+func isNumber(word string) bool {
+	for _, c := range word {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return word != ""
+}
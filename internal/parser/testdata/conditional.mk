@@ -0,0 +1,41 @@
+# Cross-platform test Makefile
+PLATFORM := linux
+DEBUG := 1
+
+ifeq ($(PLATFORM),windows)
+EXT := .exe
+RM := del /Q
+
+# Clean on Windows
+clean:
+	$(RM) app$(EXT)
+else ifeq "$(PLATFORM)" "linux"
+EXT :=
+RM := rm -f
+
+# Clean on Linux
+clean:
+	$(RM) app$(EXT)
+else
+EXT := .bin
+endif
+
+build:
+	cc -o app$(EXT) main.c
+ifdef DEBUG
+	@echo debug build
+endif
+ifndef RELEASE
+	@echo not a release
+else
+	@echo release
+endif
+
+ifneq ($(DEBUG),)
+ifdef UNDEFINED_VARIABLE
+debug-extra:
+	echo unreachable
+endif # nested
+debug:
+	gdb app$(EXT)
+endif
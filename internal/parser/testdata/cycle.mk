@@ -0,0 +1,18 @@
+# Circular dependencies
+all: a e
+
+a: b
+	@echo a
+
+b: c | a
+	@echo b
+
+c: a
+	@echo c
+
+d: d
+
+e: f
+f:
+
+.PHONY: all a b c d e f
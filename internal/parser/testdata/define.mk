@@ -0,0 +1,30 @@
+# Canned recipes and multi-line variables
+VERSION := 1.2.3
+
+define RELEASE_SCRIPT
+	@echo "releasing $(VERSION)"
+	git tag v$(VERSION) \
+		-m "release"
+endef
+
+define GREETING :=
+hello
+endef
+
+define GREETING +=
+world
+endef
+
+export define OUTER
+define INNER
+nested body
+endef
+endef # trailing comment
+
+define TEMP
+scratch
+endef
+undefine TEMP
+
+release:
+	$(RELEASE_SCRIPT)
@@ -0,0 +1,17 @@
+# Problems make reports while reading
+CC := gcc
+
+build: main.o
+    $(CC) -o app main.o
+
+	echo orphan
+CFLAGS = $(CC
+stray text
+$(info fine)
+ifeq ($(CC),gcc)
+test: build
+	./app
+else extra
+endif
+
+all: build test
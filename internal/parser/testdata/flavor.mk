@@ -0,0 +1,25 @@
+# Variable flavor test Makefile
+BASE = /usr
+RECURSIVE = $(BASE)/bin
+SIMPLE := $(BASE)/bin
+POSIX ::= $(BASE)/lib
+IMMEDIATE :::= $(BASE)/share
+BASE = /opt
+
+DEFAULTED ?= first
+DEFAULTED ?= second
+
+RFLAGS = -O2
+RFLAGS += $(LEVEL)
+SFLAGS := -O2
+SFLAGS += $(LEVEL)
+LEVEL = -g
+
+override LOCKED := fixed
+LOCKED := changed
+
+export TOKEN = secret # trailing comment
+HASH := a\#b
+NOW != date
+SPACED = foo # blanks before a comment are kept
+JOINED := $(SPACED)x
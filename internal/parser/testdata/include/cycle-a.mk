@@ -0,0 +1 @@
+include cycle-b.mk
@@ -0,0 +1 @@
+include cycle-a.mk
@@ -0,0 +1 @@
+EXTRA := from-include-dir
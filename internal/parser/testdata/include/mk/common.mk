@@ -0,0 +1,9 @@
+# Shared lint rule
+LINTER := golangci-lint
+CC := clang
+
+# Run the linter
+lint:
+	$(LINTER) run
+
+include local.mk
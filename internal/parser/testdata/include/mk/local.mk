@@ -0,0 +1 @@
+LOCAL := yes
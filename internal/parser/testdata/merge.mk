@@ -0,0 +1,21 @@
+# Build everything
+build: lib.a
+
+install: build
+	cp app /usr/local/bin
+
+build: main.o util.o
+	cc -o app $^
+
+# Print the version
+version:
+	@echo 1.0
+
+version:
+	@echo 2.0
+
+.PHONY: build install version
+
+both: a
+
+both:: b
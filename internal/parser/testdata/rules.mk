@@ -0,0 +1,27 @@
+OUTDIR := out
+
+# Build the program
+build: main.o util.o | $(OUTDIR) logs
+	cc -o $@ $^ # $|
+
+$(OUTDIR) logs:
+	mkdir -p $@
+
+# Remove objects
+clean::
+	rm -f *.o
+
+# Remove the output directory
+clean:: $(OUTDIR)
+	rm -rf $(OUTDIR)
+
+OBJS := main.o util.o
+
+$(OBJS): %.o: %.c | %.d
+	cc -c $< -o $@
+
+parser.c parser.h &: parser.y
+	bison -d $<
+
+%.pb.c: %.proto | gen
+	protoc $<
@@ -0,0 +1,5 @@
+dist: assets
+	@echo dist
+
+assets:
+	@echo assets
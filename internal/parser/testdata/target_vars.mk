@@ -0,0 +1,24 @@
+# Target-specific variable test Makefile
+CFLAGS = -O2
+MODE := release
+private SECRET := hidden
+
+all: app
+
+debug: CFLAGS += -g
+debug: MODE := debug
+debug: export VERBOSE = 1
+debug: app
+	@echo $(MODE) build with $(CFLAGS)
+
+%.o: CFLAGS += -fPIC
+lib/%.o: CFLAGS += -Ilib
+main.o: override CFLAGS += -DMAIN
+test: private TOKEN ?= abc
+test: TOKEN ?= ignored
+
+%.o: %.c
+	cc $(CFLAGS) -c $< -o $@
+
+app:
+	@echo $(SECRET)
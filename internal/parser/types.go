@@ -1,41 +1,219 @@
 package parser
 
+import "strings"
+
 // Target represents a Makefile target
 type Target struct {
-	Name         string
+	Name          string
+	Dependencies  []string
+	OrderOnly     []string // Prerequisites after '|', which never make the target out of date
+	Commands      []string
+	IsPhony       bool
+	Description   string // From comment above target
+	File          string // File the rule was read from
+	LineNumber    int
+	Condition     *ConditionalBranch // Enclosing conditional branch, nil at top level
+	Stem          string             // Stem for targets of a static pattern rule
+	StaticPattern *PatternRule       // Static pattern rule the target was defined by
+	DoubleColon   bool               // Defined with "target::"
+	Rules         []*Rule            // Every rule for the target, in the order they were read
+	Group         []string           // All targets of a grouped rule "a b &: src"
+}
+
+// Rule represents one rule contributing to a target. The prerequisites of
+// all rules for a target are merged and only the last recipe is kept,
+// except for double-colon targets where make considers each rule
+// separately and runs its recipe when its own prerequisites are newer.
+type Rule struct {
 	Dependencies []string
+	OrderOnly    []string
+	Commands     []string
+	Description  string
+	File         string
+	LineNumber   int
+	Overridden   bool // Recipe replaced by a later rule for the same target
+	Generated    bool // Read from a compiler-generated dependency file
+}
+
+// PatternRule represents a pattern rule such as "%.o: %.c", or the
+// template of a static pattern rule such as "$(OBJS): %.o: %.c"
+type PatternRule struct {
+	Targets      []string // Target patterns, e.g. "%.o"
+	Dependencies []string // Prerequisite patterns, e.g. "%.c"
+	OrderOnly    []string
 	Commands     []string
-	IsPhony      bool
-	Description  string // From comment above target
+	Description  string
+	File         string
 	LineNumber   int
+	Condition    *ConditionalBranch
+}
+
+// String returns the rule header, e.g. "%.o: %.c | $(OUTDIR)"
+func (r *PatternRule) String() string {
+	header := strings.Join(r.Targets, " ") + ": " + strings.Join(r.Dependencies, " ")
+	if len(r.OrderOnly) > 0 {
+		header += " | " + strings.Join(r.OrderOnly, " ")
+	}
+	return strings.TrimSpace(header)
+}
+
+// ImplicitMatch describes how a target is built by a pattern rule
+type ImplicitMatch struct {
+	Target       string
+	Rule         *PatternRule
+	Stem         string
+	Dependencies []string         // Prerequisites with the stem substituted
+	OrderOnly    []string         // Order-only prerequisites with the stem substituted
+	Chain        []*ImplicitMatch // Matches for intermediate prerequisites
 }
 
 // Variable represents a Makefile variable
 type Variable struct {
-	Name       string
-	Value      string
-	IsExported bool
-	IsOverride bool
-	LineNumber int
-	Type       VariableType
+	Name        string
+	Value       string // Value as make stores it; already expanded for simple variables
+	RawValue    string // Right-hand side as written in the Makefile
+	IsExported  bool
+	IsOverride  bool
+	IsPrivate   bool   // Not inherited by targets or prerequisites
+	IsMultiline bool   // Defined with define ... endef
+	File        string // File the variable was defined in
+	LineNumber  int
+	Type        VariableType
+	Flavor      VariableFlavor
+	Condition   *ConditionalBranch // Enclosing conditional branch, nil at top level
+	Target      string             // Target or pattern for target-specific variables
+	immediate   bool               // Defined with :::=, so appends are expanded and escaped
 }
 
-// VariableType represents the type of variable assignment
+// VariableType represents the operator a variable was assigned with
 type VariableType int
 
 const (
-	SimpleAssignment VariableType = iota // VAR = value
-	RecursiveAssignment                  // VAR := value
-	ConditionalAssignment                // VAR ?= value
-	AppendAssignment                     // VAR += value
+	RecursiveAssignment   VariableType = iota // VAR = value
+	SimpleAssignment                          // VAR := value or VAR ::= value
+	ImmediateAssignment                       // VAR :::= value
+	ConditionalAssignment                     // VAR ?= value
+	AppendAssignment                          // VAR += value
+	ShellAssignment                           // VAR != command
+)
+
+// String returns the name of the assignment type
+func (t VariableType) String() string {
+	switch t {
+	case RecursiveAssignment:
+		return "recursive"
+	case SimpleAssignment:
+		return "simple"
+	case ImmediateAssignment:
+		return "immediate"
+	case ConditionalAssignment:
+		return "conditional"
+	case AppendAssignment:
+		return "append"
+	case ShellAssignment:
+		return "shell"
+	}
+	return "unknown"
+}
+
+// VariableFlavor represents when a variable's value is expanded, as
+// reported by make's $(flavor ...) function
+type VariableFlavor int
+
+const (
+	RecursiveFlavor VariableFlavor = iota // Expanded each time it is referenced
+	SimpleFlavor                          // Expanded once, when it is defined
 )
 
+// String returns the flavor name used by make
+func (f VariableFlavor) String() string {
+	if f == SimpleFlavor {
+		return "simple"
+	}
+	return "recursive"
+}
+
+// ConditionalKind represents the directive that opens a conditional branch
+type ConditionalKind int
+
+const (
+	IfEq   ConditionalKind = iota // ifeq (a,b)
+	IfNeq                         // ifneq (a,b)
+	IfDef                         // ifdef VAR
+	IfNdef                        // ifndef VAR
+	Else                          // plain else
+)
+
+// String returns the directive keyword for the kind
+func (k ConditionalKind) String() string {
+	switch k {
+	case IfEq:
+		return "ifeq"
+	case IfNeq:
+		return "ifneq"
+	case IfDef:
+		return "ifdef"
+	case IfNdef:
+		return "ifndef"
+	case Else:
+		return "else"
+	}
+	return "unknown"
+}
+
+// Conditional represents an ifeq/ifneq/ifdef/ifndef ... endif block
+type Conditional struct {
+	Branches   []*ConditionalBranch
+	Parent     *ConditionalBranch // Enclosing branch for nested blocks
+	LineNumber int
+	EndLine    int
+}
+
+// ConditionalBranch represents a single branch of a conditional block.
+// An "else ifeq ..." chain is represented as further branches of the same block.
+type ConditionalBranch struct {
+	Kind        ConditionalKind
+	Condition   string // Raw condition text, e.g. "($(OS),Windows_NT)"
+	Active      bool   // Whether make would read this branch
+	LineNumber  int
+	Conditional *Conditional
+	Nested      []*Conditional
+	Targets     []*Target
+	Variables   []*Variable
+}
+
+// String returns the directive as written, e.g. "ifeq ($(OS),Windows_NT)"
+func (b *ConditionalBranch) String() string {
+	if b.Kind == Else {
+		return "else"
+	}
+	return b.Kind.String() + " " + b.Condition
+}
+
+// Path returns the chain of branches from the outermost conditional down to b
+func (b *ConditionalBranch) Path() []*ConditionalBranch {
+	var path []*ConditionalBranch
+	for br := b; br != nil; br = br.Conditional.Parent {
+		path = append([]*ConditionalBranch{br}, path...)
+	}
+	return path
+}
+
 // Makefile represents a parsed Makefile
 type Makefile struct {
 	Path      string
 	Targets   map[string]*Target
 	Variables map[string]*Variable
-	Includes  []string
+	// Target-specific assignments by target name, in definition order
+	TargetVariables map[string][]*Variable
+	// Pattern-specific assignments such as "%.o: CFLAGS += -fPIC"
+	PatternVariables []*Variable
+	PatternRules     []*PatternRule
+	Includes         []string       // Include directives as written, after expansion
+	Files            []string       // Every file read, the top-level Makefile first
+	Phony            []string       // Targets declared in .PHONY, in declaration order
+	Conditionals     []*Conditional // Top-level conditional blocks
+	Diagnostics      []*Diagnostic  // Warnings and errors found while reading
 }
 
 // DependencyGraph represents target dependencies
@@ -47,5 +225,7 @@ type DependencyGraph struct {
 type DependencyNode struct {
 	Name         string
 	Dependencies []string
+	OrderOnly    []string
+	Generated    []string // Prerequisites only listed in dependency files, e.g. headers
 	Dependents   []string
-}
\ No newline at end of file
+}
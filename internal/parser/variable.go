@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+var assignmentTypes = map[string]VariableType{
+	"":     RecursiveAssignment, // define without an operator
+	"=":    RecursiveAssignment,
+	":=":   SimpleAssignment,
+	"::=":  SimpleAssignment,
+	":::=": ImmediateAssignment,
+	"?=":   ConditionalAssignment,
+	"+=":   AppendAssignment,
+	"!=":   ShellAssignment,
+}
+
+// setVariable assigns a variable with the given assignment operator,
+// recording it on the enclosing conditional branch. The value is expanded
+// at definition time exactly when make would do so.
+func (p *Parser) setVariable(variable *Variable, operator, value string) {
+	variable.Type = assignmentTypes[operator]
+	variable.RawValue = value
+	variable.Value = value
+
+	if variable.Condition != nil {
+		variable.Condition.Variables = append(variable.Condition.Variables, variable)
+	}
+	if variable.Condition != nil && !variable.Condition.Active {
+		// Skipped branches are recorded as written, without side effects
+		return
+	}
+
+	existing, defined := p.makefile.Variables[variable.Name]
+	envValue, inEnv := os.LookupEnv(variable.Name)
+
+	// Makefile assignments can't change a variable set with override
+	if defined && existing.IsOverride && !variable.IsOverride {
+		return
+	}
+
+	switch variable.Type {
+	case SimpleAssignment:
+		variable.Flavor = SimpleFlavor
+		variable.Value = p.expandText(value)
+	case ImmediateAssignment:
+		variable.immediate = true
+		variable.Value = escapeDollars(p.expandText(value))
+	case ShellAssignment:
+		variable.Value = p.shellValue(value)
+	case ConditionalAssignment:
+		if defined || inEnv {
+			return
+		}
+	case AppendAssignment:
+		base := ""
+		switch {
+		case defined:
+			base = existing.Value
+			variable.Flavor = existing.Flavor
+			variable.immediate = existing.immediate
+			variable.IsExported = variable.IsExported || existing.IsExported
+			variable.IsOverride = variable.IsOverride || existing.IsOverride
+			variable.IsMultiline = variable.IsMultiline || existing.IsMultiline
+		case inEnv:
+			base = envValue
+		}
+		// Appended text is expanded now only if the variable is simple
+		if variable.Flavor == SimpleFlavor {
+			value = p.expandText(value)
+		} else if variable.immediate {
+			value = escapeDollars(p.expandText(value))
+		}
+		variable.Value = value
+		if base != "" {
+			variable.Value = base + " " + value
+		}
+	}
+
+	p.makefile.Variables[variable.Name] = variable
+}
+
+// shellValue runs the command of a != assignment and returns its output,
+// stored as a recursive value. Without shell access the command is kept
+// as an unexpanded $(shell ...) reference.
+func (p *Parser) shellValue(command string) string {
+	command = p.expandText(command)
+	if !p.allowShell {
+		return "$(shell " + command + ")"
+	}
+	output, _ := p.runShell(command)
+	return output
+}
+
+// TargetSpecificVariables returns the target- and pattern-specific
+// assignments that apply to target, in the order make applies them:
+// matching patterns with longer stems first, then the target's own.
+func (p *Parser) TargetSpecificVariables(target string) []*Variable {
+	type patternMatch struct {
+		variable *Variable
+		stem     int
+	}
+	var matches []patternMatch
+	for _, v := range p.makefile.PatternVariables {
+		if stem, ok := matchPattern(v.Target, target); ok {
+			matches = append(matches, patternMatch{v, len(stem)})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].stem > matches[j].stem
+	})
+
+	result := []*Variable{}
+	for _, m := range matches {
+		result = append(result, m.variable)
+	}
+	return append(result, p.makefile.TargetVariables[target]...)
+}
+
+// escapeDollars escapes '$' so an expanded value survives re-expansion
+func escapeDollars(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
@@ -1,104 +1,52 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/cappyzawa/mcp-server-makefile/internal/jsonrpc"
 	"github.com/cappyzawa/mcp-server-makefile/internal/mcp"
 )
 
-// Request represents a JSON-RPC request
-type Request struct {
-	JSONRPC string          `json:"jsonrpc"`
-	ID      interface{}     `json:"id"`
-	Method  string          `json:"method"`
-	Params  json.RawMessage `json:"params,omitempty"`
-}
+// stringList collects a repeatable string flag
+type stringList []string
 
-// Response represents a JSON-RPC response
-type Response struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      interface{} `json:"id"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   *Error      `json:"error,omitempty"`
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-// Error represents a JSON-RPC error
-type Error struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func main() {
+	var includeDirs stringList
+	flag.Var(&includeDirs, "I", "Search `dir` for included Makefiles (may be repeated)")
+	allowShell := flag.Bool("allow-shell", false, "Run $(shell ...) commands when expanding variables")
+	flag.Parse()
+
 	// Set up logging
 	log.SetFlags(0)
 	log.SetOutput(os.Stderr)
 
 	server := mcp.NewServer()
-	ctx := context.Background()
-
-	scanner := bufio.NewScanner(os.Stdin)
-	writer := bufio.NewWriter(os.Stdout)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		var req Request
-		if err := json.Unmarshal([]byte(line), &req); err != nil {
-			log.Printf("Failed to parse request: %v", err)
-			continue
-		}
-
-		var result interface{}
-		var err error
-
-		switch req.Method {
-		case "initialize":
-			result, err = server.Initialize(ctx, req.Params)
-		case "tools/list":
-			result, err = server.ListTools(ctx)
-		case "tools/call":
-			var params struct {
-				Name      string          `json:"name"`
-				Arguments json.RawMessage `json:"arguments"`
-			}
-			if err = json.Unmarshal(req.Params, &params); err == nil {
-				result, err = server.CallTool(ctx, params.Name, params.Arguments)
-			}
-		default:
-			err = fmt.Errorf("unknown method: %s", req.Method)
-		}
-
-		resp := Response{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-		}
-
-		if err != nil {
-			resp.Error = &Error{
-				Code:    -32603,
-				Message: err.Error(),
-			}
-		} else {
-			resp.Result = result
-		}
-
-		respBytes, _ := json.Marshal(resp)
-		writer.Write(respBytes)
-		writer.WriteByte('\n')
-		writer.Flush()
-	}
-
-	if err := scanner.Err(); err != nil && err != io.EOF {
+	server.SetIncludeDirs(includeDirs)
+	server.SetAllowShell(*allowShell)
+	dispatcher := jsonrpc.NewDispatcher()
+	server.Register(dispatcher)
+
+	// The client shuts the server down by closing stdin, or else with a
+	// signal; either way the message being handled is answered first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := dispatcher.Serve(ctx, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
 		log.Fatalf("Error reading input: %v", err)
 	}
-}
\ No newline at end of file
+}